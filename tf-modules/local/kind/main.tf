@@ -0,0 +1,47 @@
+resource "docker_image" "registry" {
+  name         = var.registry_image
+  keep_locally = true
+}
+
+resource "docker_container" "registry" {
+  name    = "${var.name}-registry"
+  image   = docker_image.registry.image_id
+  restart = "always"
+
+  ports {
+    internal = 5000
+    external = var.registry_port
+    ip       = "127.0.0.1"
+  }
+
+  networks_advanced {
+    name = "kind"
+  }
+
+  # The kind network is created along with the cluster.
+  depends_on = [kind_cluster.this]
+}
+
+resource "kind_cluster" "this" {
+  name           = var.name
+  node_image     = var.node_image
+  wait_for_ready = true
+
+  kind_config {
+    kind        = "Cluster"
+    api_version = "kind.x-k8s.io/v1alpha4"
+
+    # Pull images pushed to the host registry address through the registry
+    # container in the kind network.
+    containerd_config_patches = [
+      <<-TOML
+      [plugins."io.containerd.grpc.v1.cri".registry.mirrors."localhost:${var.registry_port}"]
+        endpoint = ["http://${var.name}-registry:5000"]
+      TOML
+    ]
+
+    node {
+      role = "control-plane"
+    }
+  }
+}
@@ -0,0 +1,15 @@
+output "kubeconfig" {
+  description = "kubeconfig of the created kind cluster"
+  value       = kind_cluster.this.kubeconfig
+  sensitive   = true
+}
+
+output "endpoint" {
+  description = "The endpoint of the kind cluster"
+  value       = kind_cluster.this.endpoint
+}
+
+output "registry_url" {
+  description = "URL of the local OCI registry reachable from the host and the cluster"
+  value       = "localhost:${var.registry_port}"
+}
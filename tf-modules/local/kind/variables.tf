@@ -0,0 +1,22 @@
+variable "name" {
+  description = "Name of the kind cluster and the prefix of the registry container"
+  type        = string
+}
+
+variable "node_image" {
+  description = "Node image of the kind cluster. Defaults to the kind default"
+  type        = string
+  default     = null
+}
+
+variable "registry_port" {
+  description = "Host port of the local OCI registry"
+  type        = number
+  default     = 5050
+}
+
+variable "registry_image" {
+  description = "Container image of the local OCI registry"
+  type        = string
+  default     = "registry:2"
+}
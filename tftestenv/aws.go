@@ -18,10 +18,23 @@ package tftestenv
 
 import (
 	"context"
+	"encoding/base64"
 	"fmt"
-	"log"
 	"os"
-	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/ecr"
+	"github.com/aws/aws-sdk-go-v2/service/ecrpublic"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	tfjson "github.com/hashicorp/terraform-json"
+	"golang.org/x/oauth2"
 )
 
 // Based on https://docs.aws.amazon.com/eks/latest/userguide/create-kubeconfig.html
@@ -46,38 +59,138 @@ users:
     token: %[5]s
 `
 
+const (
+	// eksClusterIDHeader is the header used by aws-iam-authenticator to bind
+	// a token to a cluster.
+	eksClusterIDHeader = "x-k8s-aws-id"
+	// eksTokenPrefix is the prefix of a v1 EKS authentication token.
+	eksTokenPrefix = "k8s-aws-v1."
+	// eksPresignExpirySeconds is the validity of the presigned request. EKS
+	// caps the token lifetime at 15 minutes regardless of this value.
+	eksPresignExpirySeconds = 60
+	// eksTokenRefreshInterval is the interval after which an EKS token is
+	// considered expired and regenerated. EKS tokens are valid for 15 minutes.
+	eksTokenRefreshInterval = 14 * time.Minute
+)
+
+// kubeConfigExecTmpl is a kubeconfig template which uses the aws CLI to
+// obtain the client token.
+const kubeConfigExecTmpl = `
+apiVersion: v1
+clusters:
+- cluster:
+    certificate-authority-data: %[1]s
+    server: %[2]s
+  name: %[3]s
+contexts:
+- context:
+    cluster: %[3]s
+    user: %[4]s
+  name: %[3]s
+current-context: %[3]s
+kind: Config
+preferences: {}
+users:
+- name: %[4]s
+  user:
+    exec:
+      apiVersion: client.authentication.k8s.io/v1beta1
+      command: aws
+      args:
+      - eks
+      - get-token
+      - --cluster-name
+      - %[3]s
+      - --region
+      - "%[5]s"
+      interactiveMode: Never
+`
+
 // kubeconfigWithClusterAuthToken returns a kubeconfig with the given cluster
 // authentication token.
 func kubeconfigWithClusterAuthToken(token, caData, endpoint, user, clusterName string) string {
 	return fmt.Sprintf(kubeConfigTmpl, caData, endpoint, clusterName, user, token)
 }
 
-// getEKSClientToken fetches the EKS cluster client token and writes into
-// workdir/token.
-func getEKSClientToken(ctx context.Context, tokenPath string, clusterName string) ([]byte, error) {
-	err := RunCommand(ctx, "./",
-		fmt.Sprintf("aws eks get-token --cluster-name %s | jq -r .status.token > %s", clusterName, tokenPath),
-		RunCommandOptions{},
-	)
+// getEKSClientToken generates an EKS cluster client token for the given
+// cluster using the default AWS credential chain, the same one used by the
+// terraform AWS provider.
+func getEKSClientToken(ctx context.Context, clusterName, clusterArn string) (string, error) {
+	client, err := newEKSSTSClient(ctx, clusterArn)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
-	return os.ReadFile(tokenPath)
+	return newEKSToken(ctx, client, clusterName)
+}
+
+// newEKSSTSClient returns an STS client configured with the default AWS
+// credential chain. The region is derived from the cluster ARN when possible.
+func newEKSSTSClient(ctx context.Context, clusterArn string) (*sts.Client, error) {
+	var region string
+	if a, err := arn.Parse(clusterArn); err == nil {
+		region = a.Region
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	return sts.NewFromConfig(cfg), nil
+}
+
+// newEKSToken returns an EKS authentication token for the given cluster. The
+// token is a presigned STS GetCallerIdentity request with the cluster name in
+// the signed x-k8s-aws-id header, as expected by aws-iam-authenticator.
+func newEKSToken(ctx context.Context, client *sts.Client, clusterName string) (string, error) {
+	presigner := sts.NewPresignClient(client, func(po *sts.PresignOptions) {
+		po.ClientOptions = append(po.ClientOptions, func(o *sts.Options) {
+			o.APIOptions = append(o.APIOptions,
+				smithyhttp.AddHeaderValue(eksClusterIDHeader, clusterName),
+				smithyhttp.AddHeaderValue("X-Amz-Expires", strconv.Itoa(eksPresignExpirySeconds)),
+			)
+		})
+	})
+	req, err := presigner.PresignGetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return "", fmt.Errorf("failed to presign STS GetCallerIdentity request: %w", err)
+	}
+	return eksTokenPrefix + base64.RawURLEncoding.EncodeToString([]byte(req.URL)), nil
 }
 
 // CreateKubeconfigEKS constructs kubeconfig from the terraform state output at
 // the given kubeconfig path.
-// func createKubeconfigEKS(ctx context.Context, state map[string]*tfjson.StateOutput, kcPath string) error {
 func CreateKubeconfigEKS(ctx context.Context, clusterName, eksHost, eksClusterArn, eksCa, kcPath string) error {
-	// Write the token next to the kubeconfig.
-	// If kcPath is build/kubeconfig, tokenPath can be build/token.
-	tokenPath := filepath.Join(filepath.Dir(kcPath), "token")
-	eksToken, err := getEKSClientToken(ctx, tokenPath, clusterName)
+	eksToken, err := getEKSClientToken(ctx, clusterName, eksClusterArn)
 	if err != nil {
 		return fmt.Errorf("failed to obtain auth token: %w", err)
 	}
 
-	kubeconfigYaml := kubeconfigWithClusterAuthToken(string(eksToken), eksCa, eksHost, eksClusterArn, clusterName)
+	kubeconfigYaml := kubeconfigWithClusterAuthToken(eksToken, eksCa, eksHost, eksClusterArn, clusterName)
+
+	f, err := os.Create(kcPath)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprint(f, kubeconfigYaml)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// CreateKubeconfigEKSExec constructs kubeconfig from the terraform state
+// output at the given kubeconfig path. Unlike CreateKubeconfigEKS, the
+// kubeconfig uses the aws CLI as an exec credential plugin instead of a static
+// token, so that it stays valid for debugging with kubectl after the token
+// would have expired. Using the kubeconfig requires the aws CLI in PATH, the
+// test clients don't need it when the kubeconfig is used along with
+// WithTokenSource and NewEKSTokenSource. The region is taken from the cluster
+// ARN.
+func CreateKubeconfigEKSExec(clusterName, eksHost, eksClusterArn, eksCa, kcPath string) error {
+	a, err := arn.Parse(eksClusterArn)
+	if err != nil {
+		return fmt.Errorf("invalid EKS cluster ARN %q: %w", eksClusterArn, err)
+	}
+	kubeconfigYaml := fmt.Sprintf(kubeConfigExecTmpl, eksCa, eksHost, clusterName, eksClusterArn, a.Region)
 
 	f, err := os.Create(kcPath)
 	if err != nil {
@@ -90,6 +203,38 @@ func CreateKubeconfigEKS(ctx context.Context, clusterName, eksHost, eksClusterAr
 	return f.Close()
 }
 
+// eksTokenSource is an oauth2.TokenSource that generates a new EKS client
+// token for every call.
+type eksTokenSource struct {
+	ctx         context.Context
+	client      *sts.Client
+	clusterName string
+}
+
+// Token implements oauth2.TokenSource.
+func (s *eksTokenSource) Token() (*oauth2.Token, error) {
+	token, err := newEKSToken(s.ctx, s.client, s.clusterName)
+	if err != nil {
+		return nil, err
+	}
+	return &oauth2.Token{
+		AccessToken: token,
+		Expiry:      time.Now().Add(eksTokenRefreshInterval),
+	}, nil
+}
+
+// NewEKSTokenSource returns a token source which generates a new EKS client
+// token for the given cluster before the previous one expires. The tokens are
+// generated with the given context, which must outlive the clients using the
+// token source.
+func NewEKSTokenSource(ctx context.Context, clusterName, eksClusterArn string) (oauth2.TokenSource, error) {
+	client, err := newEKSSTSClient(ctx, eksClusterArn)
+	if err != nil {
+		return nil, err
+	}
+	return oauth2.ReuseTokenSource(nil, &eksTokenSource{ctx: ctx, client: client, clusterName: clusterName}), nil
+}
+
 // RegistryLoginECR logs into the container/artifact registries using the
 // provider's CLI tools and returns a list of test repositories.
 func RegistryLoginECR(ctx context.Context, region, repoURL string) error {
@@ -107,10 +252,67 @@ func RegistryLoginECRPublic(ctx context.Context) error {
 	)
 }
 
-// PushTestAppImagesECR pushes app image that is being tested. It must be
-// called after RegistryLoginECR to ensure the local docker client is already
-// logged in and is capable of pushing the test images.
-func PushTestAppImagesECR(ctx context.Context, localImgs map[string]string, remoteImage string) (map[string]string, error) {
+// ecrPublicRegion is the region of the public ECR API.
+const ecrPublicRegion = "us-east-1"
+
+// ECRAuthenticator returns an authenticator for the ECR registries of the
+// given region, from an authorization token obtained with the AWS SDK default
+// credentials. Unlike RegistryLoginECR, it needs no CLI and doesn't change the
+// docker config.
+func ECRAuthenticator(ctx context.Context, region string) (authn.Authenticator, error) {
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	out, err := ecr.NewFromConfig(cfg).GetAuthorizationToken(ctx, &ecr.GetAuthorizationTokenInput{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ECR authorization token: %w", err)
+	}
+	if len(out.AuthorizationData) == 0 || out.AuthorizationData[0].AuthorizationToken == nil {
+		return nil, fmt.Errorf("no ECR authorization token returned")
+	}
+	return authenticatorFromBasicToken(*out.AuthorizationData[0].AuthorizationToken)
+}
+
+// ECRPublicAuthenticator returns an authenticator for public ECR, from an
+// authorization token obtained with the AWS SDK default credentials. Unlike
+// RegistryLoginECRPublic, it needs no CLI and doesn't change the docker
+// config.
+func ECRPublicAuthenticator(ctx context.Context) (authn.Authenticator, error) {
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(ecrPublicRegion))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	out, err := ecrpublic.NewFromConfig(cfg).GetAuthorizationToken(ctx, &ecrpublic.GetAuthorizationTokenInput{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get public ECR authorization token: %w", err)
+	}
+	if out.AuthorizationData == nil || out.AuthorizationData.AuthorizationToken == nil {
+		return nil, fmt.Errorf("no public ECR authorization token returned")
+	}
+	return authenticatorFromBasicToken(*out.AuthorizationData.AuthorizationToken)
+}
+
+// authenticatorFromBasicToken returns an authenticator from an ECR
+// authorization token, the base64 encoded username:password.
+func authenticatorFromBasicToken(token string) (authn.Authenticator, error) {
+	b, err := base64.StdEncoding.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode authorization token: %w", err)
+	}
+	username, password, ok := strings.Cut(string(b), ":")
+	if !ok {
+		return nil, fmt.Errorf("invalid authorization token")
+	}
+	return &authn.Basic{Username: username, Password: password}, nil
+}
+
+// PushTestAppImagesECR pushes app image that is being tested. Without remote
+// options, like remote.WithAuth with ECRAuthenticator, it must be called after
+// RegistryLoginECR to ensure the local docker client is already logged in and
+// is capable of pushing the test images. It returns the pushed image, keyed by
+// the name of the local image.
+func PushTestAppImagesECR(ctx context.Context, localImgs map[string]string, remoteImage string, opts ...remote.Option) (map[string]PushedImage, error) {
 	// NOTE: Unlike Azure Container Registry and Google Artifact Registry, ECR
 	// does not support dynamic image repositories. A new repository for a new
 	// image has to be explicitly created. Therefore, the single local image
@@ -125,23 +327,83 @@ func PushTestAppImagesECR(ctx context.Context, localImgs map[string]string, remo
 		name, localImage = n, i
 	}
 
-	if err := RunCommand(ctx, "./",
-		fmt.Sprintf("docker tag %s %s", localImage, remoteImage),
-		RunCommandOptions{},
-	); err != nil {
+	digest, err := RetagAndPush(ctx, localImage, remoteImage, opts...)
+	if err != nil {
 		return nil, err
 	}
 
-	log.Printf("pushing flux test image %s\n", remoteImage)
+	return map[string]PushedImage{
+		name: {Ref: remoteImage, Digest: digest},
+	}, nil
+}
+
+// Terraform outputs used by AWSProvider.
+const (
+	awsOutputClusterName = "eks_cluster_name"
+	awsOutputClusterHost = "eks_cluster_endpoint"
+	awsOutputClusterArn  = "eks_cluster_arn"
+	awsOutputClusterCA   = "eks_cluster_ca_certificate"
+	awsOutputRegion      = "region"
+	awsOutputRepoURL     = "ecr_repository_url"
+)
+
+// AWSProvider is the Provider for EKS clusters and ECR repositories. It
+// expects the terraform outputs eks_cluster_name, eks_cluster_endpoint,
+// eks_cluster_arn, eks_cluster_ca_certificate, region and ecr_repository_url.
+type AWSProvider struct{}
+
+// Name implements Provider.
+func (AWSProvider) Name() string {
+	return "aws"
+}
+
+// RequiredOutputs implements Provider.
+func (AWSProvider) RequiredOutputs(op Operation) []string {
+	if op == OperationRegistry {
+		return []string{awsOutputRegion, awsOutputRepoURL}
+	}
+	return []string{awsOutputClusterName, awsOutputClusterHost, awsOutputClusterArn, awsOutputClusterCA}
+}
+
+// CreateKubeconfig implements Provider.
+func (AWSProvider) CreateKubeconfig(ctx context.Context, state map[string]*tfjson.StateOutput, kcPath string) error {
+	v, err := stateOutputStrings(state, awsOutputClusterName, awsOutputClusterHost, awsOutputClusterArn, awsOutputClusterCA)
+	if err != nil {
+		return err
+	}
+	return CreateKubeconfigEKS(ctx, v[0], v[1], v[2], v[3], kcPath)
+}
 
-	if err := RunCommand(ctx, "./",
-		fmt.Sprintf("docker push %s", remoteImage),
-		RunCommandOptions{},
-	); err != nil {
+// RegistryLogin implements Provider.
+func (AWSProvider) RegistryLogin(ctx context.Context, state map[string]*tfjson.StateOutput) (string, error) {
+	v, err := stateOutputStrings(state, awsOutputRegion, awsOutputRepoURL)
+	if err != nil {
+		return "", err
+	}
+	if err := RegistryLoginECR(ctx, v[0], v[1]); err != nil {
+		return "", err
+	}
+	return v[1], nil
+}
+
+// RegistryAuthenticator implements Provider.
+func (AWSProvider) RegistryAuthenticator(ctx context.Context, state map[string]*tfjson.StateOutput) (authn.Authenticator, error) {
+	region, err := stateOutputString(state, awsOutputRegion)
+	if err != nil {
 		return nil, err
 	}
+	return ECRAuthenticator(ctx, region)
+}
 
-	return map[string]string{
-		name: remoteImage,
-	}, nil
+// PushTestAppImages implements Provider. ECR supports pushing one image only.
+func (p AWSProvider) PushTestAppImages(ctx context.Context, state map[string]*tfjson.StateOutput, localImgs map[string]string) (map[string]PushedImage, error) {
+	repoURL, err := stateOutputString(state, awsOutputRepoURL)
+	if err != nil {
+		return nil, err
+	}
+	auth, err := p.RegistryAuthenticator(ctx, state)
+	if err != nil {
+		return nil, err
+	}
+	return PushTestAppImagesECR(ctx, localImgs, repoURL+":test", remote.WithAuth(auth))
 }
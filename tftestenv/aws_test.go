@@ -0,0 +1,133 @@
+/*
+Copyright 2026 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tftestenv
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	. "github.com/onsi/gomega"
+)
+
+const stsGetCallerIdentityResponse = `<GetCallerIdentityResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <GetCallerIdentityResult>
+    <Arn>arn:aws:iam::123456789012:user/test</Arn>
+    <UserId>AIDATEST</UserId>
+    <Account>123456789012</Account>
+  </GetCallerIdentityResult>
+</GetCallerIdentityResponse>`
+
+func TestNewEKSToken(t *testing.T) {
+	g := NewWithT(t)
+
+	// Local STS stand-in which only accepts GetCallerIdentity requests bound
+	// to the expected cluster, like the EKS authenticator does.
+	var gotClusterID string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("Action") != "GetCallerIdentity" ||
+			!strings.Contains(q.Get("X-Amz-SignedHeaders"), eksClusterIDHeader) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		gotClusterID = r.Header.Get(eksClusterIDHeader)
+		fmt.Fprint(w, stsGetCallerIdentityResponse)
+	}))
+	defer srv.Close()
+
+	client := sts.New(sts.Options{
+		Region:       "us-east-2",
+		Credentials:  credentials.NewStaticCredentialsProvider("AKIDTEST", "SECRET", ""),
+		BaseEndpoint: aws.String(srv.URL),
+	})
+
+	token, err := newEKSToken(context.TODO(), client, "flux-test")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(token).To(HavePrefix(eksTokenPrefix))
+
+	rawURL, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(token, eksTokenPrefix))
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(string(rawURL)).To(HavePrefix(srv.URL))
+	g.Expect(string(rawURL)).To(ContainSubstring("X-Amz-Expires=60"))
+
+	// Replay the presigned request the way the EKS authenticator would.
+	req, err := http.NewRequest(http.MethodGet, string(rawURL), nil)
+	g.Expect(err).ToNot(HaveOccurred())
+	req.Header.Set(eksClusterIDHeader, "flux-test")
+	resp, err := http.DefaultClient.Do(req)
+	g.Expect(err).ToNot(HaveOccurred())
+	defer resp.Body.Close()
+	g.Expect(resp.StatusCode).To(Equal(http.StatusOK))
+	g.Expect(gotClusterID).To(Equal("flux-test"))
+}
+
+func TestEKSTokenSource(t *testing.T) {
+	g := NewWithT(t)
+
+	client := sts.New(sts.Options{
+		Region:      "us-east-2",
+		Credentials: credentials.NewStaticCredentialsProvider("AKIDTEST", "SECRET", ""),
+	})
+	ts := &eksTokenSource{ctx: context.TODO(), client: client, clusterName: "flux-test"}
+
+	tok, err := ts.Token()
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(tok.AccessToken).To(HavePrefix(eksTokenPrefix))
+	g.Expect(tok.Valid()).To(BeTrue())
+	g.Expect(tok.Expiry).To(BeTemporally("~", time.Now().Add(eksTokenRefreshInterval), time.Minute))
+}
+
+func TestCreateKubeconfigEKSExec(t *testing.T) {
+	g := NewWithT(t)
+
+	kcPath := filepath.Join(t.TempDir(), "kubeconfig")
+	g.Expect(CreateKubeconfigEKSExec("flux-test", "https://eks.example.com", "arn:aws:eks:us-east-2:123456789012:cluster/flux-test", "Y2E=", kcPath)).To(Succeed())
+	b, err := os.ReadFile(kcPath)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(string(b)).To(ContainSubstring(`- "us-east-2"`))
+
+	err = CreateKubeconfigEKSExec("flux-test", "https://eks.example.com", "flux-test", "Y2E=", kcPath)
+	g.Expect(err).To(MatchError(ContainSubstring("invalid EKS cluster ARN")))
+}
+
+func TestAuthenticatorFromBasicToken(t *testing.T) {
+	g := NewWithT(t)
+
+	token := base64.StdEncoding.EncodeToString([]byte("AWS:pass:word"))
+	auth, err := authenticatorFromBasicToken(token)
+	g.Expect(err).ToNot(HaveOccurred())
+	cfg, err := auth.Authorization()
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(cfg.Username).To(Equal("AWS"))
+	g.Expect(cfg.Password).To(Equal("pass:word"))
+
+	_, err = authenticatorFromBasicToken(base64.StdEncoding.EncodeToString([]byte("nocolon")))
+	g.Expect(err).To(HaveOccurred())
+	_, err = authenticatorFromBasicToken("not base64!")
+	g.Expect(err).To(HaveOccurred())
+}
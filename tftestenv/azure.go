@@ -18,8 +18,18 @@ package tftestenv
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/url"
 	"os"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	tfjson "github.com/hashicorp/terraform-json"
 )
 
 // CreateKubeconfigAKS constructs kubeconfig for an AKS cluster from the
@@ -45,19 +55,148 @@ func RegistryLoginACR(ctx context.Context, registryURL string) error {
 	)
 }
 
-// PushTestAppImagesACR pushes app images that are being tested. It must be
-// called after RegistryLoginACR to ensure the local docker client is already
-// logged in and is capable of pushing the test images.
-func PushTestAppImagesACR(ctx context.Context, localImgs map[string]string, registryURL string) (map[string]string, error) {
-	imageRepo := map[string]string{}
+// acrTokenUsername is the username of the ACR refresh tokens.
+const acrTokenUsername = "00000000-0000-0000-0000-000000000000"
+
+// acrScope is the scope of the Azure AD token exchanged for an ACR refresh
+// token.
+const acrScope = "https://management.azure.com/.default"
+
+// ACRAuthenticator returns an authenticator for the given ACR registry, from
+// an ACR refresh token exchanged for an Azure AD token of the Azure SDK
+// default credentials. Unlike RegistryLoginACR, it needs no CLI and doesn't
+// change the docker config.
+func ACRAuthenticator(ctx context.Context, registryURL string) (authn.Authenticator, error) {
+	cred, err := azidentity.NewDefaultAzureCredential(nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Azure credentials: %w", err)
+	}
+	token, err := cred.GetToken(ctx, policy.TokenRequestOptions{Scopes: []string{acrScope}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Azure AD token: %w", err)
+	}
+	refreshToken, err := exchangeACRRefreshToken(ctx, "https://"+registryURL, registryURL, token.Token)
+	if err != nil {
+		return nil, err
+	}
+	return &authn.Basic{Username: acrTokenUsername, Password: refreshToken}, nil
+}
+
+// exchangeACRRefreshToken exchanges the given Azure AD access token for an
+// ACR refresh token of the given registry service at the given endpoint.
+func exchangeACRRefreshToken(ctx context.Context, endpoint, service, accessToken string) (string, error) {
+	form := url.Values{
+		"grant_type":   {"access_token"},
+		"service":      {service},
+		"access_token": {accessToken},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint+"/oauth2/exchange", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to exchange ACR refresh token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to exchange ACR refresh token: %s", resp.Status)
+	}
+
+	var result struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("failed to decode ACR refresh token: %w", err)
+	}
+	if result.RefreshToken == "" {
+		return "", fmt.Errorf("no ACR refresh token returned")
+	}
+	return result.RefreshToken, nil
+}
+
+// PushTestAppImagesACR pushes app images that are being tested. Without remote
+// options, like remote.WithAuth with ACRAuthenticator, it must be called after
+// RegistryLoginACR to ensure the local docker client is already logged in and
+// is capable of pushing the test images. It returns the pushed images, keyed
+// by the names of the local images.
+func PushTestAppImagesACR(ctx context.Context, localImgs map[string]string, registryURL string, opts ...remote.Option) (map[string]PushedImage, error) {
+	imageRepo := map[string]PushedImage{}
 
 	for name, image := range localImgs {
 		remoteImg := fmt.Sprintf("%s/%s:test", registryURL, name)
-		err := RetagAndPush(ctx, image, remoteImg)
+		digest, err := RetagAndPush(ctx, image, remoteImg, opts...)
 		if err != nil {
 			return nil, err
 		}
-		imageRepo[name] = remoteImg
+		imageRepo[name] = PushedImage{Ref: remoteImg, Digest: digest}
 	}
 	return imageRepo, nil
 }
+
+// Terraform outputs used by AzureProvider.
+const (
+	azureOutputKubeconfig  = "aks_kubeconfig"
+	azureOutputRegistryURL = "acr_registry_url"
+)
+
+// AzureProvider is the Provider for AKS clusters and ACR registries. It
+// expects the terraform outputs aks_kubeconfig and acr_registry_url.
+type AzureProvider struct{}
+
+// Name implements Provider.
+func (AzureProvider) Name() string {
+	return "azure"
+}
+
+// RequiredOutputs implements Provider.
+func (AzureProvider) RequiredOutputs(op Operation) []string {
+	if op == OperationRegistry {
+		return []string{azureOutputRegistryURL}
+	}
+	return []string{azureOutputKubeconfig}
+}
+
+// CreateKubeconfig implements Provider.
+func (AzureProvider) CreateKubeconfig(ctx context.Context, state map[string]*tfjson.StateOutput, kcPath string) error {
+	kubeconfigYaml, err := stateOutputString(state, azureOutputKubeconfig)
+	if err != nil {
+		return err
+	}
+	return CreateKubeconfigAKS(ctx, kubeconfigYaml, kcPath)
+}
+
+// RegistryLogin implements Provider.
+func (AzureProvider) RegistryLogin(ctx context.Context, state map[string]*tfjson.StateOutput) (string, error) {
+	registryURL, err := stateOutputString(state, azureOutputRegistryURL)
+	if err != nil {
+		return "", err
+	}
+	if err := RegistryLoginACR(ctx, registryURL); err != nil {
+		return "", err
+	}
+	return registryURL, nil
+}
+
+// RegistryAuthenticator implements Provider.
+func (AzureProvider) RegistryAuthenticator(ctx context.Context, state map[string]*tfjson.StateOutput) (authn.Authenticator, error) {
+	registryURL, err := stateOutputString(state, azureOutputRegistryURL)
+	if err != nil {
+		return nil, err
+	}
+	return ACRAuthenticator(ctx, registryURL)
+}
+
+// PushTestAppImages implements Provider.
+func (p AzureProvider) PushTestAppImages(ctx context.Context, state map[string]*tfjson.StateOutput, localImgs map[string]string) (map[string]PushedImage, error) {
+	registryURL, err := stateOutputString(state, azureOutputRegistryURL)
+	if err != nil {
+		return nil, err
+	}
+	auth, err := p.RegistryAuthenticator(ctx, state)
+	if err != nil {
+		return nil, err
+	}
+	return PushTestAppImagesACR(ctx, localImgs, registryURL, remote.WithAuth(auth))
+}
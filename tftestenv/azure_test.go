@@ -0,0 +1,54 @@
+/*
+Copyright 2026 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tftestenv
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestExchangeACRRefreshToken(t *testing.T) {
+	g := NewWithT(t)
+
+	// Local ACR stand-in which only exchanges the expected AAD token.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/oauth2/exchange" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.FormValue("grant_type") != "access_token" ||
+			r.FormValue("service") != "flux.azurecr.io" ||
+			r.FormValue("access_token") != "aad-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `{"refresh_token":"acr-token"}`)
+	}))
+	defer srv.Close()
+
+	token, err := exchangeACRRefreshToken(context.TODO(), srv.URL, "flux.azurecr.io", "aad-token")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(token).To(Equal("acr-token"))
+
+	_, err = exchangeACRRefreshToken(context.TODO(), srv.URL, "flux.azurecr.io", "wrong-token")
+	g.Expect(err).To(MatchError(ContainSubstring("401")))
+}
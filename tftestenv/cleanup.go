@@ -0,0 +1,224 @@
+/*
+Copyright 2026 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tftestenv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+)
+
+// cleanupPollInterval is the interval at which the deletion of the cleaned up
+// objects is checked.
+const cleanupPollInterval = 5 * time.Second
+
+// WithCloudResourceCleanup configures Stop, and Destroy when a kubeconfig can
+// be created from the state, to delete the Kubernetes objects backed by cloud
+// resources that terraform doesn't know about before destroying the
+// infrastructure. Services of type LoadBalancer, Ingresses and
+// PersistentVolumeClaims are deleted in all namespaces, and their deletion,
+// including the PersistentVolumes of the claims, is waited for within the
+// given timeout. Claims still mounted by pods would be kept by the
+// pvc-protection finalizer until the cluster is destroyed, so they aren't
+// deleted and are left to the cluster deletion. A zero timeout waits until the
+// context is done.
+func WithCloudResourceCleanup(timeout time.Duration) EnvironmentOption {
+	return func(e *Environment) {
+		e.cleanup = true
+		e.cleanupTimeout = timeout
+	}
+}
+
+// cloudObject is a Kubernetes object backed by a cloud resource.
+type cloudObject struct {
+	kind      string
+	namespace string
+	name      string
+}
+
+func (o cloudObject) String() string {
+	if o.namespace == "" {
+		return fmt.Sprintf("%s/%s", o.kind, o.name)
+	}
+	return fmt.Sprintf("%s/%s/%s", o.kind, o.namespace, o.name)
+}
+
+// cleanupCloudObjects deletes the Kubernetes objects backed by cloud
+// resources and waits for them to be deleted.
+func (env *Environment) cleanupCloudObjects(ctx context.Context) error {
+	if !env.cleanup || env.ClientGo == nil {
+		return nil
+	}
+	ctx = logr.NewContext(ctx, env.phaseLogger("cleanup"))
+	return cleanupCloudObjects(ctx, env.ClientGo, env.cleanupTimeout)
+}
+
+// cleanupCloudObjects deletes the Services of type LoadBalancer, Ingresses and
+// PersistentVolumeClaims in all namespaces and waits for them, and the
+// PersistentVolumes bound to the claims, to be deleted within the timeout.
+// Claims mounted by pods aren't deleted.
+func cleanupCloudObjects(ctx context.Context, c kubernetes.Interface, timeout time.Duration) error {
+	logger := loggerFrom(ctx)
+	logger.Info("Cleaning up cloud-backed Kubernetes objects...")
+	ctx, cancel := phaseContext(ctx, timeout)
+	defer cancel()
+
+	objects, err := listCloudObjects(ctx, c, nil)
+	if err != nil {
+		return err
+	}
+	inUse, err := claimsInUse(ctx, c)
+	if err != nil {
+		return err
+	}
+
+	// Record the volumes of the claims before deleting them.
+	var volumes []string
+	var errs []error
+	for _, o := range objects {
+		var err error
+		switch o.kind {
+		case "Service":
+			err = c.CoreV1().Services(o.namespace).Delete(ctx, o.name, metav1.DeleteOptions{})
+		case "Ingress":
+			err = c.NetworkingV1().Ingresses(o.namespace).Delete(ctx, o.name, metav1.DeleteOptions{})
+		case "PersistentVolumeClaim":
+			if inUse[o] {
+				logger.Info("PersistentVolumeClaim is in use, skipping its deletion", "claim", o.String())
+				continue
+			}
+			var pvc *corev1.PersistentVolumeClaim
+			pvc, err = c.CoreV1().PersistentVolumeClaims(o.namespace).Get(ctx, o.name, metav1.GetOptions{})
+			if err == nil {
+				if pvc.Spec.VolumeName != "" {
+					volumes = append(volumes, pvc.Spec.VolumeName)
+				}
+				err = c.CoreV1().PersistentVolumeClaims(o.namespace).Delete(ctx, o.name, metav1.DeleteOptions{})
+			}
+		}
+		if err != nil && !apierrors.IsNotFound(err) {
+			errs = append(errs, fmt.Errorf("failed to delete %s: %w", o, err))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+
+	var remaining []cloudObject
+	err = wait.PollImmediateUntilWithContext(ctx, cleanupPollInterval, func(ctx context.Context) (bool, error) {
+		objects, err := listCloudObjects(ctx, c, volumes)
+		if err != nil {
+			return false, err
+		}
+		remaining = remaining[:0]
+		for _, o := range objects {
+			if !inUse[o] {
+				remaining = append(remaining, o)
+			}
+		}
+		return len(remaining) == 0, nil
+	})
+	if err != nil {
+		if len(remaining) > 0 {
+			names := make([]string, 0, len(remaining))
+			for _, o := range remaining {
+				names = append(names, o.String())
+			}
+			return fmt.Errorf("timed out waiting for the deletion of %s: %w", strings.Join(names, ", "), err)
+		}
+		return fmt.Errorf("failed to wait for the deletion of cloud-backed objects: %w", err)
+	}
+	return nil
+}
+
+// claimsInUse returns the PersistentVolumeClaims mounted by pods that haven't
+// terminated.
+func claimsInUse(ctx context.Context, c kubernetes.Interface) (map[cloudObject]bool, error) {
+	pods, err := c.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list Pods: %w", err)
+	}
+	inUse := map[cloudObject]bool{}
+	for _, pod := range pods.Items {
+		if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		for _, v := range pod.Spec.Volumes {
+			if v.PersistentVolumeClaim != nil {
+				inUse[cloudObject{kind: "PersistentVolumeClaim", namespace: pod.Namespace, name: v.PersistentVolumeClaim.ClaimName}] = true
+			}
+		}
+	}
+	return inUse, nil
+}
+
+// listCloudObjects returns the Services of type LoadBalancer, Ingresses and
+// PersistentVolumeClaims in all namespaces, and the given PersistentVolumes
+// that still exist.
+func listCloudObjects(ctx context.Context, c kubernetes.Interface, volumes []string) ([]cloudObject, error) {
+	var objects []cloudObject
+
+	svcs, err := c.CoreV1().Services(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list Services: %w", err)
+	}
+	for _, svc := range svcs.Items {
+		if svc.Spec.Type == corev1.ServiceTypeLoadBalancer {
+			objects = append(objects, cloudObject{kind: "Service", namespace: svc.Namespace, name: svc.Name})
+		}
+	}
+
+	ings, err := c.NetworkingV1().Ingresses(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list Ingresses: %w", err)
+	}
+	for _, ing := range ings.Items {
+		objects = append(objects, cloudObject{kind: "Ingress", namespace: ing.Namespace, name: ing.Name})
+	}
+
+	pvcs, err := c.CoreV1().PersistentVolumeClaims(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list PersistentVolumeClaims: %w", err)
+	}
+	for _, pvc := range pvcs.Items {
+		objects = append(objects, cloudObject{kind: "PersistentVolumeClaim", namespace: pvc.Namespace, name: pvc.Name})
+	}
+
+	for _, v := range volumes {
+		pv, err := c.CoreV1().PersistentVolumes().Get(ctx, v, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get PersistentVolume %s: %w", v, err)
+		}
+		// Retained volumes aren't deleted along with the claim.
+		if pv.Spec.PersistentVolumeReclaimPolicy == corev1.PersistentVolumeReclaimDelete {
+			objects = append(objects, cloudObject{kind: "PersistentVolume", name: pv.Name})
+		}
+	}
+	return objects, nil
+}
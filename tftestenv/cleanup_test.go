@@ -0,0 +1,127 @@
+/*
+Copyright 2026 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tftestenv
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func cloudObjects() []runtime.Object {
+	return []runtime.Object{
+		&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "lb", Namespace: "default"},
+			Spec:       corev1.ServiceSpec{Type: corev1.ServiceTypeLoadBalancer},
+		},
+		&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "internal", Namespace: "default"},
+			Spec:       corev1.ServiceSpec{Type: corev1.ServiceTypeClusterIP},
+		},
+		&networkingv1.Ingress{
+			ObjectMeta: metav1.ObjectMeta{Name: "ing", Namespace: "app"},
+		},
+		&corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: "data", Namespace: "app"},
+			Spec:       corev1.PersistentVolumeClaimSpec{VolumeName: "pv-data"},
+		},
+		&corev1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: "pv-data"},
+			Spec: corev1.PersistentVolumeSpec{
+				PersistentVolumeReclaimPolicy: corev1.PersistentVolumeReclaimRetain,
+			},
+		},
+	}
+}
+
+func TestCleanupCloudObjects(t *testing.T) {
+	g := NewWithT(t)
+
+	c := fake.NewSimpleClientset(cloudObjects()...)
+	g.Expect(cleanupCloudObjects(context.Background(), c, time.Minute)).To(Succeed())
+
+	remaining, err := listCloudObjects(context.Background(), c, nil)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(remaining).To(BeEmpty())
+
+	// Objects that aren't backed by cloud resources are kept.
+	_, err = c.CoreV1().Services("default").Get(context.Background(), "internal", metav1.GetOptions{})
+	g.Expect(err).ToNot(HaveOccurred())
+}
+
+func TestCleanupCloudObjects_timeout(t *testing.T) {
+	g := NewWithT(t)
+
+	c := fake.NewSimpleClientset(cloudObjects()...)
+	// Keep the LoadBalancer Service as if a finalizer was blocking its
+	// deletion.
+	c.PrependReactor("delete", "services", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, nil
+	})
+
+	err := cleanupCloudObjects(context.Background(), c, 100*time.Millisecond)
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(err.Error()).To(ContainSubstring("Service/default/lb"))
+	g.Expect(err.Error()).ToNot(ContainSubstring("Ingress"))
+}
+
+func TestEnvironment_cleanupCloudObjects(t *testing.T) {
+	g := NewWithT(t)
+
+	// Without clients, the cleanup is skipped even if enabled.
+	env := &Environment{}
+	WithCloudResourceCleanup(time.Minute)(env)
+	g.Expect(env.cleanup).To(BeTrue())
+	g.Expect(env.cleanupTimeout).To(Equal(time.Minute))
+	g.Expect(env.cleanupCloudObjects(context.Background())).To(Succeed())
+}
+
+func TestCleanupCloudObjects_claimInUse(t *testing.T) {
+	g := NewWithT(t)
+
+	objects := append(cloudObjects(),
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "db-0", Namespace: "app"},
+			Spec: corev1.PodSpec{Volumes: []corev1.Volume{{
+				Name: "data",
+				VolumeSource: corev1.VolumeSource{
+					PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "data"},
+				},
+			}}},
+			Status: corev1.PodStatus{Phase: corev1.PodRunning},
+		},
+	)
+	c := fake.NewSimpleClientset(objects...)
+
+	// The claim in use is neither deleted nor waited for.
+	g.Expect(cleanupCloudObjects(context.Background(), c, 100*time.Millisecond)).To(Succeed())
+	_, err := c.CoreV1().PersistentVolumeClaims("app").Get(context.Background(), "data", metav1.GetOptions{})
+	g.Expect(err).ToNot(HaveOccurred())
+	for _, a := range c.Actions() {
+		if d, ok := a.(k8stesting.DeleteAction); ok && d.GetResource().Resource == "persistentvolumeclaims" {
+			g.Expect(d.GetName()).ToNot(Equal("data"))
+		}
+	}
+}
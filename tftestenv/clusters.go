@@ -0,0 +1,147 @@
+/*
+Copyright 2026 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tftestenv
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Cluster is a handle of one of the clusters of a multi-cluster Environment.
+type Cluster struct {
+	client.Client
+	ClientGo *kubernetes.Clientset
+	Config   *rest.Config
+
+	// Name is the name of the cluster.
+	Name string
+	// KubeconfigPath is the path of the kubeconfig of the cluster.
+	KubeconfigPath string
+}
+
+// SplitClusterOutputs splits the terraform state outputs into the outputs of
+// every cluster, keyed by cluster name. The outputs of every cluster are
+// passed to CreateKubeconfig to construct the kubeconfig of the cluster.
+type SplitClusterOutputs func(state map[string]*tfjson.StateOutput) (map[string]map[string]*tfjson.StateOutput, error)
+
+// WithClusters configures the Environment to create a named cluster handle,
+// with its own kubeconfig and clients, for every cluster returned by split.
+// The kubeconfig of a cluster is written next to the environment kubeconfig
+// with the cluster name as suffix, for example build/kubeconfig-hub. The
+// embedded clients of the Environment and the environment kubeconfig are
+// those of the defaultCluster, or of the first cluster in name order if
+// defaultCluster is empty.
+func WithClusters(split SplitClusterOutputs, defaultCluster string) EnvironmentOption {
+	return func(e *Environment) {
+		e.splitClusters = split
+		e.defaultCluster = defaultCluster
+	}
+}
+
+// ClustersFromOutput returns a SplitClusterOutputs which reads the outputs of
+// every cluster from the given terraform output. The output must be an object
+// keyed by cluster name whose values are objects of the cluster outputs, for
+// example:
+//
+//	output "clusters" {
+//	  value = {
+//	    hub   = { aks_kubeconfig = module.hub.kubeconfig, ... }
+//	    spoke = { aks_kubeconfig = module.spoke.kubeconfig, ... }
+//	  }
+//	  sensitive = true
+//	}
+func ClustersFromOutput(name string) SplitClusterOutputs {
+	return func(state map[string]*tfjson.StateOutput) (map[string]map[string]*tfjson.StateOutput, error) {
+		o, ok := state[name]
+		if !ok || o == nil || o.Value == nil {
+			return nil, fmt.Errorf("output %q not found", name)
+		}
+		clusters, ok := o.Value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("output %q is %T, expected an object of clusters", name, o.Value)
+		}
+
+		result := map[string]map[string]*tfjson.StateOutput{}
+		for cluster, v := range clusters {
+			values, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("output %q of cluster %q is %T, expected an object", name, cluster, v)
+			}
+			outputs := map[string]*tfjson.StateOutput{}
+			for k, val := range values {
+				outputs[k] = &tfjson.StateOutput{Sensitive: o.Sensitive, Value: val}
+			}
+			result[cluster] = outputs
+		}
+		return result, nil
+	}
+}
+
+// configureClusters creates a cluster handle for every cluster in the state
+// outputs and configures the Environment with the default cluster.
+func (env *Environment) configureClusters(ctx context.Context, scheme *runtime.Scheme, outputs map[string]*tfjson.StateOutput, kubeconfigPath string) error {
+	clusterOutputs, err := env.splitClusters(outputs)
+	if err != nil {
+		return fmt.Errorf("failed to read cluster outputs: %w", err)
+	}
+	if len(clusterOutputs) == 0 {
+		return fmt.Errorf("no clusters found in the state outputs")
+	}
+
+	names := make([]string, 0, len(clusterOutputs))
+	for name := range clusterOutputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	env.Clusters = map[string]*Cluster{}
+	for _, name := range names {
+		c, err := env.newCluster(ctx, scheme, name, clusterOutputs[name], kubeconfigPath+"-"+name)
+		if err != nil {
+			return fmt.Errorf("failed to configure cluster %q: %w", name, err)
+		}
+		env.Clusters[name] = c
+	}
+
+	defaultCluster := env.defaultCluster
+	if defaultCluster == "" {
+		defaultCluster = names[0]
+	}
+	c, ok := env.Clusters[defaultCluster]
+	if !ok {
+		return fmt.Errorf("default cluster %q not found in %v", defaultCluster, names)
+	}
+
+	// Keep the environment kubeconfig valid for the default cluster.
+	kubeconfig, err := os.ReadFile(c.KubeconfigPath)
+	if err != nil {
+		return fmt.Errorf("failed to read kubeconfig of cluster %q: %w", defaultCluster, err)
+	}
+	if err := os.WriteFile(kubeconfigPath, kubeconfig, 0o600); err != nil {
+		return fmt.Errorf("failed to write kubeconfig: %w", err)
+	}
+	env.setDefaultCluster(c)
+	return nil
+}
@@ -0,0 +1,163 @@
+/*
+Copyright 2026 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tftestenv
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	. "github.com/onsi/gomega"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+)
+
+func TestClustersFromOutput(t *testing.T) {
+	tests := []struct {
+		name    string
+		state   map[string]*tfjson.StateOutput
+		want    map[string]map[string]*tfjson.StateOutput
+		wantErr string
+	}{
+		{
+			name: "clusters object",
+			state: map[string]*tfjson.StateOutput{
+				"clusters": {
+					Sensitive: true,
+					Value: map[string]interface{}{
+						"hub":   map[string]interface{}{"aks_kubeconfig": "hub-kubeconfig"},
+						"spoke": map[string]interface{}{"aks_kubeconfig": "spoke-kubeconfig"},
+					},
+				},
+			},
+			want: map[string]map[string]*tfjson.StateOutput{
+				"hub":   {"aks_kubeconfig": {Sensitive: true, Value: "hub-kubeconfig"}},
+				"spoke": {"aks_kubeconfig": {Sensitive: true, Value: "spoke-kubeconfig"}},
+			},
+		},
+		{
+			name:    "missing output",
+			state:   map[string]*tfjson.StateOutput{},
+			wantErr: `output "clusters" not found`,
+		},
+		{
+			name: "not an object",
+			state: map[string]*tfjson.StateOutput{
+				"clusters": {Value: "foo"},
+			},
+			wantErr: "expected an object of clusters",
+		},
+		{
+			name: "cluster not an object",
+			state: map[string]*tfjson.StateOutput{
+				"clusters": {Value: map[string]interface{}{"hub": "foo"}},
+			},
+			wantErr: `cluster "hub"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			got, err := ClustersFromOutput("clusters")(tt.state)
+			if tt.wantErr != "" {
+				g.Expect(err).To(MatchError(ContainSubstring(tt.wantErr)))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(got).To(Equal(tt.want))
+		})
+	}
+}
+
+func TestConfigureClusters(t *testing.T) {
+	// Every cluster has its own API server.
+	var authorizations []string
+	servers := map[string]string{}
+	clusters := map[string]interface{}{}
+	for _, name := range []string{"hub", "spoke"} {
+		srv := discoveryAPIServer(&authorizations)
+		defer srv.Close()
+		servers[name] = srv.URL
+		clusters[name] = map[string]interface{}{"local_kubeconfig": testKubeconfig(srv.URL, "static")}
+	}
+	state := map[string]*tfjson.StateOutput{
+		"clusters": {Sensitive: true, Value: clusters},
+	}
+
+	tests := []struct {
+		name           string
+		defaultCluster string
+		wantDefault    string
+		wantErr        string
+	}{
+		{
+			name:        "first cluster in name order",
+			wantDefault: "hub",
+		},
+		{
+			name:           "configured default cluster",
+			defaultCluster: "spoke",
+			wantDefault:    "spoke",
+		},
+		{
+			name:           "unknown default cluster",
+			defaultCluster: "edge",
+			wantErr:        `default cluster "edge" not found in [hub spoke]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			env := &Environment{
+				provider:         LocalProvider{},
+				CreateKubeconfig: LocalProvider{}.CreateKubeconfig,
+			}
+			WithClusters(ClustersFromOutput("clusters"), tt.defaultCluster)(env)
+
+			kubeconfigPath := filepath.Join(t.TempDir(), "kubeconfig")
+			err := env.configureClusters(context.TODO(), clientgoscheme.Scheme, state, kubeconfigPath)
+			if tt.wantErr != "" {
+				g.Expect(err).To(MatchError(ContainSubstring(tt.wantErr)))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+
+			g.Expect(env.Clusters).To(HaveLen(2))
+			for name, c := range env.Clusters {
+				g.Expect(c.Name).To(Equal(name))
+				g.Expect(c.KubeconfigPath).To(Equal(kubeconfigPath + "-" + name))
+				g.Expect(c.Config.Host).To(Equal(servers[name]))
+				b, err := os.ReadFile(c.KubeconfigPath)
+				g.Expect(err).ToNot(HaveOccurred())
+				g.Expect(string(b)).To(Equal(testKubeconfig(servers[name], "static")))
+			}
+
+			// The environment kubeconfig and clients are those of the
+			// default cluster.
+			b, err := os.ReadFile(kubeconfigPath)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(string(b)).To(Equal(testKubeconfig(servers[tt.wantDefault], "static")))
+			g.Expect(env.Config).To(BeIdenticalTo(env.Clusters[tt.wantDefault].Config))
+			g.Expect(env.ClientGo).To(BeIdenticalTo(env.Clusters[tt.wantDefault].ClientGo))
+		})
+	}
+}
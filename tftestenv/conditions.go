@@ -0,0 +1,326 @@
+/*
+Copyright 2026 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tftestenv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/yaml"
+)
+
+// readyCondition is the type of the Flux Ready condition.
+const readyCondition = "Ready"
+
+// ObjectPredicate reports whether an object, in its unstructured form, is in
+// the awaited state.
+type ObjectPredicate func(obj *unstructured.Unstructured) (bool, error)
+
+// ConditionTrue returns an ObjectPredicate satisfied when the condition of the
+// given type has status True.
+func ConditionTrue(condType string) ObjectPredicate {
+	return func(obj *unstructured.Unstructured) (bool, error) {
+		cond, err := findCondition(obj, condType)
+		if err != nil || cond == nil {
+			return false, err
+		}
+		return cond["status"] == string(metav1.ConditionTrue), nil
+	}
+}
+
+// ReadyTrue returns an ObjectPredicate satisfied when the Ready condition has
+// status True.
+func ReadyTrue() ObjectPredicate {
+	return ConditionTrue(readyCondition)
+}
+
+// ConditionReason returns an ObjectPredicate satisfied when the condition of
+// the given type has the given reason.
+func ConditionReason(condType, reason string) ObjectPredicate {
+	return func(obj *unstructured.Unstructured) (bool, error) {
+		cond, err := findCondition(obj, condType)
+		if err != nil || cond == nil {
+			return false, err
+		}
+		return cond["reason"] == reason, nil
+	}
+}
+
+// ObservedGenerationMatch returns an ObjectPredicate satisfied when the
+// status observedGeneration is the generation of the object.
+func ObservedGenerationMatch() ObjectPredicate {
+	return func(obj *unstructured.Unstructured) (bool, error) {
+		observed, found, err := unstructured.NestedInt64(obj.Object, "status", "observedGeneration")
+		if err != nil || !found {
+			return false, err
+		}
+		return observed == obj.GetGeneration(), nil
+	}
+}
+
+// RevisionChanged returns an ObjectPredicate satisfied when the revision of
+// the object, as returned by ObjectRevision, is set and differs from the
+// given previous revision.
+func RevisionChanged(previous string) ObjectPredicate {
+	return func(obj *unstructured.Unstructured) (bool, error) {
+		revision, err := unstructuredRevision(obj)
+		if err != nil {
+			return false, err
+		}
+		return revision != "" && revision != previous, nil
+	}
+}
+
+// ObjectRevision returns the revision of a Flux object: the
+// lastAppliedRevision of appliers like Kustomization and HelmRelease, or the
+// artifact revision of sources like GitRepository and OCIRepository.
+func ObjectRevision(obj client.Object) (string, error) {
+	u, err := toUnstructured(obj)
+	if err != nil {
+		return "", err
+	}
+	return unstructuredRevision(u)
+}
+
+// WaitError is returned when an object didn't reach the awaited state in
+// time. It has the last seen status of the object and its events.
+type WaitError struct {
+	// Object identifies the object as Kind/namespace/name.
+	Object string
+	// Status is the last seen status of the object.
+	Status map[string]interface{}
+	// Events are the events of the object.
+	Events []corev1.Event
+	// Err is the cause of the failure.
+	Err error
+}
+
+// Error implements error.
+func (e *WaitError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s not ready: %v", e.Object, e.Err)
+	if s, err := yaml.Marshal(e.Status); err == nil && e.Status != nil {
+		fmt.Fprintf(&b, "\nlast seen status:\n%s", s)
+	}
+	if len(e.Events) > 0 {
+		b.WriteString("\nevents:")
+		for _, ev := range e.Events {
+			fmt.Fprintf(&b, "\n  %s %s: %s", ev.Type, ev.Reason, ev.Message)
+		}
+	}
+	return b.String()
+}
+
+// Unwrap returns the cause of the failure.
+func (e *WaitError) Unwrap() error {
+	return e.Err
+}
+
+// WaitForCondition waits until the given object satisfies all the given
+// predicates, by watching it. The object is updated with its state in the
+// cluster. On timeout, a WaitError with the last seen status and the events of
+// the object is returned.
+func (env *Environment) WaitForCondition(ctx context.Context, obj client.Object, timeout time.Duration, predicates ...ObjectPredicate) error {
+	c, err := client.NewWithWatch(env.Config, client.Options{
+		Scheme: env.Client.Scheme(),
+		Mapper: env.Client.RESTMapper(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create watch client: %w", err)
+	}
+	return waitForCondition(ctx, c, obj, timeout, predicates...)
+}
+
+// WaitForReady waits until the given object is Ready with its latest
+// generation observed. See WaitForCondition.
+func (env *Environment) WaitForReady(ctx context.Context, obj client.Object, timeout time.Duration) error {
+	return env.WaitForCondition(ctx, obj, timeout, ReadyTrue(), ObservedGenerationMatch())
+}
+
+// waitForCondition watches the given object until it satisfies the
+// predicates.
+func waitForCondition(ctx context.Context, c client.WithWatch, obj client.Object, timeout time.Duration, predicates ...ObjectPredicate) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	gvk, err := apiutil.GVKForObject(obj, c.Scheme())
+	if err != nil {
+		return err
+	}
+	key := client.ObjectKeyFromObject(obj)
+	id := fmt.Sprintf("%s/%s", gvk.Kind, key)
+	if key.Namespace == "" {
+		id = fmt.Sprintf("%s/%s", gvk.Kind, key.Name)
+	}
+
+	var last *unstructured.Unstructured
+	for {
+		// Start from the current state, and watch from its resource version
+		// so that no change is missed.
+		if err := c.Get(ctx, key, obj); err != nil {
+			if ctx.Err() != nil {
+				return waitError(c, id, obj, last, ctx.Err())
+			}
+			return err
+		}
+		current, err := toUnstructured(obj)
+		if err != nil {
+			return err
+		}
+		last = current
+		if ok, err := matchAll(current, predicates); err != nil || ok {
+			return err
+		}
+
+		list := &unstructured.UnstructuredList{}
+		list.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+		w, err := c.Watch(ctx, list, client.InNamespace(key.Namespace), &client.ListOptions{Raw: &metav1.ListOptions{
+			FieldSelector:   fields.OneTermEqualSelector("metadata.name", key.Name).String(),
+			ResourceVersion: obj.GetResourceVersion(),
+		}})
+		if err != nil {
+			return fmt.Errorf("failed to watch %s: %w", id, err)
+		}
+
+		done, err := watchUntil(ctx, w.ResultChan(), key.Name, predicates, &last)
+		w.Stop()
+		if err != nil {
+			return err
+		}
+		if done {
+			return c.Get(ctx, key, obj)
+		}
+		if ctx.Err() != nil {
+			return waitError(c, id, obj, last, ctx.Err())
+		}
+		// The watch was closed by the server, start over.
+	}
+}
+
+// watchUntil consumes the given watch events until an event of the named
+// object satisfies the predicates, the watch is closed or the context is
+// done. The last seen object is recorded.
+func watchUntil(ctx context.Context, events <-chan watch.Event, name string, predicates []ObjectPredicate, last **unstructured.Unstructured) (bool, error) {
+	for {
+		select {
+		case <-ctx.Done():
+			return false, nil
+		case ev, ok := <-events:
+			if !ok {
+				return false, nil
+			}
+			if ev.Object == nil {
+				continue
+			}
+			u, err := toUnstructured(ev.Object)
+			if err != nil {
+				continue
+			}
+			// Watch errors are Status objects.
+			if u.GetKind() == "Status" || u.GetName() != name {
+				continue
+			}
+			*last = u
+			if matched, err := matchAll(u, predicates); err != nil || matched {
+				return matched, err
+			}
+		}
+	}
+}
+
+// matchAll returns true if the given object satisfies all the predicates.
+func matchAll(obj *unstructured.Unstructured, predicates []ObjectPredicate) (bool, error) {
+	for _, p := range predicates {
+		ok, err := p(obj)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// waitError returns a WaitError with the last seen status and the events of
+// the given object.
+func waitError(c client.Client, id string, obj client.Object, last *unstructured.Unstructured, cause error) error {
+	werr := &WaitError{Object: id, Err: cause}
+	if last != nil {
+		werr.Status, _, _ = unstructured.NestedMap(last.Object, "status")
+	}
+
+	// Use a new context as the wait context is done.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	events := &corev1.EventList{}
+	if err := c.List(ctx, events, client.InNamespace(obj.GetNamespace())); err != nil {
+		werr.Err = errors.Join(cause, fmt.Errorf("failed to list events: %w", err))
+		return werr
+	}
+	for _, ev := range events.Items {
+		if ev.InvolvedObject.Name == obj.GetName() && (ev.InvolvedObject.UID == "" || ev.InvolvedObject.UID == obj.GetUID()) {
+			werr.Events = append(werr.Events, ev)
+		}
+	}
+	return werr
+}
+
+// findCondition returns the condition of the given type of the object, or nil.
+func findCondition(obj *unstructured.Unstructured, condType string) (map[string]interface{}, error) {
+	conditions, _, err := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range conditions {
+		cond, ok := c.(map[string]interface{})
+		if ok && cond["type"] == condType {
+			return cond, nil
+		}
+	}
+	return nil, nil
+}
+
+// unstructuredRevision returns the revision of the given Flux object.
+func unstructuredRevision(obj *unstructured.Unstructured) (string, error) {
+	revision, found, err := unstructured.NestedString(obj.Object, "status", "lastAppliedRevision")
+	if err != nil || found {
+		return revision, err
+	}
+	revision, _, err = unstructured.NestedString(obj.Object, "status", "artifact", "revision")
+	return revision, err
+}
+
+// toUnstructured returns the given object in its unstructured form.
+func toUnstructured(obj runtime.Object) (*unstructured.Unstructured, error) {
+	if u, ok := obj.(*unstructured.Unstructured); ok {
+		return u.DeepCopy(), nil
+	}
+	m, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	return &unstructured.Unstructured{Object: m}, nil
+}
@@ -0,0 +1,126 @@
+/*
+Copyright 2026 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tftestenv
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newGitRepository(status map[string]interface{}) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "source.toolkit.fluxcd.io/v1beta2",
+		"kind":       "GitRepository",
+		"metadata": map[string]interface{}{
+			"name":       "podinfo",
+			"namespace":  "flux-system",
+			"generation": int64(2),
+		},
+	}}
+	if status != nil {
+		obj.Object["status"] = status
+	}
+	return obj
+}
+
+func readyStatus(reason string, generation int64, revision string) map[string]interface{} {
+	return map[string]interface{}{
+		"observedGeneration": generation,
+		"artifact":           map[string]interface{}{"revision": revision},
+		"conditions": []interface{}{
+			map[string]interface{}{"type": "Ready", "status": "True", "reason": reason},
+		},
+	}
+}
+
+func TestObjectPredicates(t *testing.T) {
+	g := NewWithT(t)
+
+	obj := newGitRepository(readyStatus("Succeeded", 2, "main@sha1:abc"))
+	for _, p := range []ObjectPredicate{
+		ReadyTrue(),
+		ConditionReason("Ready", "Succeeded"),
+		ObservedGenerationMatch(),
+		RevisionChanged("main@sha1:123"),
+	} {
+		g.Expect(p(obj)).To(BeTrue())
+	}
+	for _, p := range []ObjectPredicate{
+		ConditionTrue("Reconciling"),
+		ConditionReason("Ready", "Failed"),
+		RevisionChanged("main@sha1:abc"),
+	} {
+		g.Expect(p(obj)).To(BeFalse())
+	}
+
+	g.Expect(ObservedGenerationMatch()(newGitRepository(readyStatus("Succeeded", 1, "")))).To(BeFalse())
+	g.Expect(ObjectRevision(obj)).To(Equal("main@sha1:abc"))
+}
+
+func TestWaitForCondition(t *testing.T) {
+	g := NewWithT(t)
+
+	c := fake.NewClientBuilder().WithObjects(newGitRepository(nil)).Build()
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		obj := newGitRepository(nil)
+		if err := c.Get(context.Background(), client.ObjectKeyFromObject(obj), obj); err != nil {
+			return
+		}
+		obj.Object["status"] = readyStatus("Succeeded", 2, "main@sha1:abc")
+		_ = c.Update(context.Background(), obj)
+	}()
+
+	obj := newGitRepository(nil)
+	err := waitForCondition(context.Background(), c, obj, 5*time.Second, ReadyTrue(), ObservedGenerationMatch())
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(ObjectRevision(obj)).To(Equal("main@sha1:abc"))
+}
+
+func TestWaitForCondition_timeout(t *testing.T) {
+	g := NewWithT(t)
+
+	c := fake.NewClientBuilder().WithObjects(
+		newGitRepository(readyStatus("GitOperationFailed", 2, "")),
+		&corev1.Event{
+			ObjectMeta:     metav1.ObjectMeta{Name: "evt", Namespace: "flux-system"},
+			InvolvedObject: corev1.ObjectReference{Kind: "GitRepository", Name: "podinfo"},
+			Type:           corev1.EventTypeWarning,
+			Reason:         "GitOperationFailed",
+			Message:        "failed to checkout",
+		},
+	).Build()
+
+	obj := newGitRepository(nil)
+	err := waitForCondition(context.Background(), c, obj, 100*time.Millisecond, ConditionReason("Ready", "Succeeded"))
+	var werr *WaitError
+	g.Expect(errors.As(err, &werr)).To(BeTrue())
+	g.Expect(werr.Object).To(Equal("GitRepository/flux-system/podinfo"))
+	g.Expect(werr.Status).To(HaveKey("conditions"))
+	g.Expect(werr.Events).To(HaveLen(1))
+	g.Expect(err.Error()).To(ContainSubstring("failed to checkout"))
+}
@@ -0,0 +1,185 @@
+/*
+Copyright 2026 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tftestenv
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	tfjson "github.com/hashicorp/terraform-json"
+)
+
+// leftoversFile is the name of the file in the build directory with the
+// resources left after destroy failed.
+const leftoversFile = "leftovers.json"
+
+// LeftoverResource is a resource left in the terraform state after destroy
+// failed.
+type LeftoverResource struct {
+	// Address is the terraform address of the resource.
+	Address string `json:"address"`
+	// Type is the terraform resource type.
+	Type string `json:"type"`
+	// ID is the ID of the resource, if known.
+	ID string `json:"id,omitempty"`
+	// Provider is the name of the terraform provider of the resource.
+	Provider string `json:"provider"`
+}
+
+// DestroyError is returned when the infrastructure couldn't be destroyed. It
+// contains the resources left in the terraform state, which are also written
+// to leftovers.json in the build directory.
+type DestroyError struct {
+	// Leftovers are the resources left in the terraform state.
+	Leftovers []LeftoverResource
+	// Err is the destroy error.
+	Err error
+}
+
+// Error implements error.
+func (e *DestroyError) Error() string {
+	return fmt.Sprintf("could not destroy infrastructure, %d resources left: %v", len(e.Leftovers), e.Err)
+}
+
+// Unwrap returns the destroy error.
+func (e *DestroyError) Unwrap() error {
+	return e.Err
+}
+
+// WithDestroyRetries configures the number of times terraform destroy is
+// retried when it fails with a retryable TerraformError. The delay before the
+// first retry is backoff, and it's doubled for every retry.
+func WithDestroyRetries(retries int, backoff time.Duration) EnvironmentOption {
+	return func(e *Environment) {
+		e.destroyRetries = retries
+		e.destroyBackoff = backoff
+	}
+}
+
+// destroy runs terraform destroy with retries. After the final failure, the
+// resources left in the state are written to the build directory and returned
+// in a DestroyError. On success, the workspace of the environment is deleted.
+// The given context is expected to be the destroy context.
+func (env *Environment) destroy(ctx context.Context) error {
+	err := env.destroyWithRetries(ctx)
+	if err == nil {
+		// The infrastructure is gone, a failure to delete the workspace
+		// leaves no resources behind.
+		return env.deleteWorkspace(ctx)
+	}
+
+	// Use a new context to read the state in case the destroy context is
+	// done.
+	stateCtx, stateCancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer stateCancel()
+	leftovers, lerr := env.leftoverResources(stateCtx)
+	if lerr != nil {
+		return errors.Join(&DestroyError{Err: err}, lerr)
+	}
+	if werr := writeLeftovers(filepath.Join(env.buildDir, leftoversFile), leftovers); werr != nil {
+		return errors.Join(&DestroyError{Leftovers: leftovers, Err: err}, werr)
+	}
+	return &DestroyError{Leftovers: leftovers, Err: err}
+}
+
+// destroyWithRetries runs terraform destroy and retries it with exponential
+// backoff as long as it fails with a retryable TerraformError.
+func (env *Environment) destroyWithRetries(ctx context.Context) error {
+	stopOutput := env.phaseOutput("destroy")
+	defer stopOutput()
+
+	start := time.Now()
+	for attempt := 0; ; attempt++ {
+		err := env.tf.Destroy(ctx, env.tfDestroyOptions...)
+		if err == nil {
+			env.logPhaseDone("destroy", start)
+			return nil
+		}
+		tfErr := classifyError(err)
+		if attempt >= env.destroyRetries || !tfErr.Retryable() || ctx.Err() != nil {
+			return phaseError(ctx, "destroy", env.destroyTimeout(), tfErr)
+		}
+
+		delay := env.destroyBackoff << attempt
+		env.phaseLogger("destroy").Info("Destroy failed, retrying", "class", tfErr.Class, "delay", delay,
+			"attempt", attempt+1, "retries", env.destroyRetries, "error", tfErr.Error())
+		select {
+		case <-ctx.Done():
+		case <-time.After(delay):
+		}
+	}
+}
+
+// leftoverResources returns the managed resources in the terraform state.
+func (env *Environment) leftoverResources(ctx context.Context) ([]LeftoverResource, error) {
+	state, err := env.tf.Show(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("could not read state: %w", err)
+	}
+	if state.Values == nil {
+		return nil, nil
+	}
+	return collectResources(state.Values.RootModule), nil
+}
+
+// collectResources returns the managed resources of the given module and its
+// child modules.
+func collectResources(m *tfjson.StateModule) []LeftoverResource {
+	if m == nil {
+		return nil
+	}
+	var resources []LeftoverResource
+	for _, r := range m.Resources {
+		if r.Mode != tfjson.ManagedResourceMode {
+			continue
+		}
+		lr := LeftoverResource{
+			Address:  r.Address,
+			Type:     r.Type,
+			Provider: r.ProviderName,
+		}
+		if id, ok := r.AttributeValues["id"].(string); ok {
+			lr.ID = id
+		}
+		resources = append(resources, lr)
+	}
+	for _, child := range m.ChildModules {
+		resources = append(resources, collectResources(child)...)
+	}
+	return resources
+}
+
+// writeLeftovers writes the given leftover resources as JSON to the given
+// path.
+func writeLeftovers(path string, leftovers []LeftoverResource) error {
+	if leftovers == nil {
+		leftovers = []LeftoverResource{}
+	}
+	b, err := json.MarshalIndent(leftovers, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode leftover resources: %w", err)
+	}
+	if err := os.WriteFile(path, b, 0o644); err != nil {
+		return fmt.Errorf("failed to write leftover resources: %w", err)
+	}
+	return nil
+}
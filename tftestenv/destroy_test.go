@@ -0,0 +1,178 @@
+/*
+Copyright 2026 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tftestenv
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform-exec/tfexec"
+	tfjson "github.com/hashicorp/terraform-json"
+	. "github.com/onsi/gomega"
+)
+
+func TestCollectResources(t *testing.T) {
+	g := NewWithT(t)
+
+	root := &tfjson.StateModule{
+		Resources: []*tfjson.StateResource{
+			{
+				Address:         "random_pet.suffix",
+				Mode:            tfjson.ManagedResourceMode,
+				Type:            "random_pet",
+				ProviderName:    "registry.terraform.io/hashicorp/random",
+				AttributeValues: map[string]interface{}{"id": "brave-fox"},
+			},
+			{
+				Address:      "data.aws_region.current",
+				Mode:         tfjson.DataResourceMode,
+				Type:         "aws_region",
+				ProviderName: "registry.terraform.io/hashicorp/aws",
+			},
+		},
+		ChildModules: []*tfjson.StateModule{
+			{
+				Address: "module.eks",
+				Resources: []*tfjson.StateResource{
+					{
+						Address:         "module.eks.aws_eks_cluster.this[0]",
+						Mode:            tfjson.ManagedResourceMode,
+						Type:            "aws_eks_cluster",
+						ProviderName:    "registry.terraform.io/hashicorp/aws",
+						AttributeValues: map[string]interface{}{"id": "flux-test-brave-fox"},
+					},
+				},
+			},
+		},
+	}
+
+	want := []LeftoverResource{
+		{
+			Address:  "random_pet.suffix",
+			Type:     "random_pet",
+			ID:       "brave-fox",
+			Provider: "registry.terraform.io/hashicorp/random",
+		},
+		{
+			Address:  "module.eks.aws_eks_cluster.this[0]",
+			Type:     "aws_eks_cluster",
+			ID:       "flux-test-brave-fox",
+			Provider: "registry.terraform.io/hashicorp/aws",
+		},
+	}
+	got := collectResources(root)
+	g.Expect(got).To(Equal(want))
+
+	path := filepath.Join(t.TempDir(), leftoversFile)
+	g.Expect(writeLeftovers(path, got)).To(Succeed())
+	b, err := os.ReadFile(path)
+	g.Expect(err).ToNot(HaveOccurred())
+	var written []LeftoverResource
+	g.Expect(json.Unmarshal(b, &written)).To(Succeed())
+	g.Expect(written).To(Equal(want))
+}
+
+func TestDestroyWithRetries(t *testing.T) {
+	const (
+		unavailable = "Error: deleting Resource Group: unexpected status code 503 from the management API"
+		denied      = "Error: googleapi: Error 403: Permission denied on resource project flux-test., forbidden"
+	)
+
+	tests := []struct {
+		name         string
+		retries      int
+		failures     []string
+		wantAttempts int
+		wantClass    ErrorClass
+	}{
+		{
+			name:         "retry transient error",
+			retries:      3,
+			failures:     []string{unavailable},
+			wantAttempts: 2,
+		},
+		{
+			name:         "stop on permanent error",
+			retries:      3,
+			failures:     []string{unavailable, denied},
+			wantAttempts: 2,
+			wantClass:    ErrorClassAuthFailure,
+		},
+		{
+			name:         "retries exhausted",
+			retries:      1,
+			failures:     []string{unavailable, unavailable},
+			wantAttempts: 2,
+			wantClass:    ErrorClassTransient,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			tf := failingDestroyTerraform(t, tt.failures...)
+			env := &Environment{tf: tf}
+			WithDestroyRetries(tt.retries, time.Millisecond)(env)
+			err := env.destroyWithRetries(context.TODO())
+			attempts, rerr := os.ReadFile(filepath.Join(tf.WorkingDir(), "attempts"))
+			g.Expect(rerr).ToNot(HaveOccurred())
+			g.Expect(string(attempts)).To(Equal(fmt.Sprintf("%d\n", tt.wantAttempts)))
+			if tt.wantClass == "" {
+				g.Expect(err).ToNot(HaveOccurred())
+				return
+			}
+			var tfErr *TerraformError
+			g.Expect(errors.As(err, &tfErr)).To(BeTrue())
+			g.Expect(tfErr.Class).To(Equal(tt.wantClass))
+		})
+	}
+}
+
+// failingDestroyTerraform returns a terraform stand-in whose destroy fails
+// with the given outputs, one per attempt, and succeeds afterwards. The
+// attempts are counted in the file "attempts" of its working directory.
+func failingDestroyTerraform(t *testing.T, failures ...string) *tfexec.Terraform {
+	t.Helper()
+	dir := t.TempDir()
+	for i, out := range failures {
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("failure-%d", i+1)), []byte(out), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	script := `#!/bin/sh
+cd "` + dir + `"
+n=$(($(cat attempts 2>/dev/null || echo 0) + 1))
+echo $n > attempts
+if [ -f "failure-$n" ]; then cat "failure-$n" >&2; exit 1; fi
+`
+	tfPath := filepath.Join(dir, "terraform")
+	if err := os.WriteFile(tfPath, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	tf, err := tfexec.NewTerraform(dir, tfPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tf
+}
@@ -0,0 +1,206 @@
+/*
+Copyright 2026 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tftestenv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+// diagnosticsDir is the name of the directory in the build directory with the
+// diagnostics bundles.
+const diagnosticsDir = "diagnostics"
+
+// DiagnosticsOptions configures the content of a diagnostics bundle.
+type DiagnosticsOptions struct {
+	// Namespaces are the namespaces whose pods and pod logs are collected,
+	// including the logs of the previous instance of restarted containers.
+	Namespaces []string
+	// GVKs are the kinds of the custom resources collected in all namespaces,
+	// for example the Flux kinds under test.
+	GVKs []schema.GroupVersionKind
+}
+
+// WithDiagnosticsOnFailure configures Stop to collect a diagnostics bundle
+// before destroying the infrastructure when failed returns true, for example
+// when the exit code of m.Run is non-zero in TestMain. Failing to collect the
+// diagnostics doesn't prevent the destroy.
+func WithDiagnosticsOnFailure(failed func() bool, opts DiagnosticsOptions) EnvironmentOption {
+	return func(e *Environment) {
+		e.diagnosticsOnFailure = failed
+		e.diagnosticsOpts = opts
+	}
+}
+
+// nodeConditions are the conditions of a node in a diagnostics bundle.
+type nodeConditions struct {
+	Name       string                 `json:"name"`
+	Conditions []corev1.NodeCondition `json:"conditions"`
+}
+
+// CollectDiagnostics dumps the namespaces, the events, the node conditions,
+// the pods and pod logs of the given namespaces and the custom resources of
+// the given kinds of the cluster into a new directory under
+// build/diagnostics, and returns the directory. The collection is best
+// effort: everything that can be collected is written, and the errors are
+// returned aggregated.
+func (env *Environment) CollectDiagnostics(ctx context.Context, opts DiagnosticsOptions) (string, error) {
+	if env.ClientGo == nil || env.Client == nil {
+		return "", errors.New("the clients of the environment are not configured")
+	}
+	dir := filepath.Join(env.buildDir, diagnosticsDir, time.Now().Format("20060102-150405"))
+	env.phaseLogger("diagnostics").Info("Collecting diagnostics", "dir", dir)
+	return dir, collectDiagnostics(ctx, env.ClientGo, env.Client, dir, opts)
+}
+
+// runDiagnosticsOnFailure collects a diagnostics bundle if configured and the
+// failure function reports a failure.
+func (env *Environment) runDiagnosticsOnFailure(ctx context.Context) {
+	if env.diagnosticsOnFailure == nil || env.Client == nil || !env.diagnosticsOnFailure() {
+		return
+	}
+	if _, err := env.CollectDiagnostics(ctx, env.diagnosticsOpts); err != nil {
+		env.phaseLogger("diagnostics").Error(err, "Failed to collect diagnostics")
+	}
+}
+
+// collectDiagnostics writes the diagnostics bundle in the given directory.
+func collectDiagnostics(ctx context.Context, c kubernetes.Interface, cl client.Client, dir string, opts DiagnosticsOptions) error {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create diagnostics directory: %w", err)
+	}
+
+	var errs []error
+	if namespaces, err := c.CoreV1().Namespaces().List(ctx, metav1.ListOptions{}); err != nil {
+		errs = append(errs, fmt.Errorf("failed to list namespaces: %w", err))
+	} else {
+		errs = append(errs, writeYAML(filepath.Join(dir, "namespaces.yaml"), namespaces))
+	}
+
+	if events, err := c.CoreV1().Events(metav1.NamespaceAll).List(ctx, metav1.ListOptions{}); err != nil {
+		errs = append(errs, fmt.Errorf("failed to list events: %w", err))
+	} else {
+		errs = append(errs, writeYAML(filepath.Join(dir, "events.yaml"), events))
+	}
+
+	if nodes, err := c.CoreV1().Nodes().List(ctx, metav1.ListOptions{}); err != nil {
+		errs = append(errs, fmt.Errorf("failed to list nodes: %w", err))
+	} else {
+		conditions := make([]nodeConditions, 0, len(nodes.Items))
+		for _, node := range nodes.Items {
+			conditions = append(conditions, nodeConditions{Name: node.Name, Conditions: node.Status.Conditions})
+		}
+		errs = append(errs, writeYAML(filepath.Join(dir, "nodes.yaml"), conditions))
+	}
+
+	for _, ns := range opts.Namespaces {
+		errs = append(errs, collectPods(ctx, c, filepath.Join(dir, "namespaces", ns), ns))
+	}
+
+	for _, gvk := range opts.GVKs {
+		list := &unstructured.UnstructuredList{}
+		list.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+		if err := cl.List(ctx, list); err != nil {
+			errs = append(errs, fmt.Errorf("failed to list %s: %w", gvk, err))
+			continue
+		}
+		name := strings.ToLower(fmt.Sprintf("%s_%s_%s.yaml", gvk.Group, gvk.Version, gvk.Kind))
+		errs = append(errs, writeYAML(filepath.Join(dir, "resources", name), list))
+	}
+
+	return errors.Join(errs...)
+}
+
+// collectPods writes the pods of the given namespace and the logs of their
+// containers in the given directory. For restarted containers, the logs of the
+// previous instance are also written, as the current logs of a crash-looping
+// container are often empty.
+func collectPods(ctx context.Context, c kubernetes.Interface, dir, namespace string) error {
+	pods, err := c.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list pods in %s: %w", namespace, err)
+	}
+	errs := []error{writeYAML(filepath.Join(dir, "pods.yaml"), pods)}
+
+	for _, pod := range pods.Items {
+		var containers []corev1.Container
+		containers = append(containers, pod.Spec.InitContainers...)
+		containers = append(containers, pod.Spec.Containers...)
+		restarted := map[string]bool{}
+		for _, status := range append(pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses...) {
+			restarted[status.Name] = status.RestartCount > 0
+		}
+		for _, container := range containers {
+			path := filepath.Join(dir, "logs", pod.Name, container.Name+".log")
+			errs = append(errs, writePodLogs(ctx, c, path, namespace, pod.Name, container.Name, false))
+			if restarted[container.Name] {
+				path := filepath.Join(dir, "logs", pod.Name, container.Name+".previous.log")
+				errs = append(errs, writePodLogs(ctx, c, path, namespace, pod.Name, container.Name, true))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// writePodLogs writes the logs of the given container, or of its previous
+// instance, to the given path.
+func writePodLogs(ctx context.Context, c kubernetes.Interface, path, namespace, pod, container string, previous bool) error {
+	stream, err := c.CoreV1().Pods(namespace).GetLogs(pod, &corev1.PodLogOptions{Container: container, Previous: previous}).Stream(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get logs of %s/%s/%s: %w", namespace, pod, container, err)
+	}
+	defer stream.Close()
+
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := io.Copy(f, stream); err != nil {
+		return fmt.Errorf("failed to write logs of %s/%s/%s: %w", namespace, pod, container, err)
+	}
+	return nil
+}
+
+// writeYAML writes the given object as YAML to the given path.
+func writeYAML(path string, obj any) error {
+	b, err := yaml.Marshal(obj)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", filepath.Base(path), err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0o644)
+}
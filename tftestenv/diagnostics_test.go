@@ -0,0 +1,190 @@
+/*
+Copyright 2026 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tftestenv
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestCollectDiagnostics(t *testing.T) {
+	g := NewWithT(t)
+
+	c := kubefake.NewSimpleClientset(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "flux-system"}},
+		readyNode("node-1", true),
+		&corev1.Event{
+			ObjectMeta: metav1.ObjectMeta{Name: "evt", Namespace: "flux-system"},
+			Reason:     "BackOff",
+		},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "source-controller", Namespace: "flux-system"},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{Name: "manager"}},
+			},
+			Status: corev1.PodStatus{
+				ContainerStatuses: []corev1.ContainerStatus{{Name: "manager", RestartCount: 3}},
+			},
+		},
+	)
+	cl := fake.NewClientBuilder().WithObjects(&appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "source-controller", Namespace: "flux-system"},
+	}).Build()
+
+	dir := t.TempDir()
+	err := collectDiagnostics(context.Background(), c, cl, dir, DiagnosticsOptions{
+		Namespaces: []string{"flux-system"},
+		GVKs:       []schema.GroupVersionKind{appsv1.SchemeGroupVersion.WithKind("Deployment")},
+	})
+	g.Expect(err).ToNot(HaveOccurred())
+
+	for _, f := range []string{
+		"namespaces.yaml",
+		"events.yaml",
+		"nodes.yaml",
+		"namespaces/flux-system/pods.yaml",
+		"namespaces/flux-system/logs/source-controller/manager.log",
+		"namespaces/flux-system/logs/source-controller/manager.previous.log",
+		"resources/apps_v1_deployment.yaml",
+	} {
+		g.Expect(filepath.Join(dir, f)).To(BeAnExistingFile())
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, "nodes.yaml"))
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(string(b)).To(ContainSubstring("node-1"))
+	b, err = os.ReadFile(filepath.Join(dir, "events.yaml"))
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(string(b)).To(ContainSubstring("BackOff"))
+	b, err = os.ReadFile(filepath.Join(dir, "resources/apps_v1_deployment.yaml"))
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(string(b)).To(ContainSubstring("source-controller"))
+}
+
+func TestRunDiagnosticsOnFailure(t *testing.T) {
+	g := NewWithT(t)
+
+	var called bool
+	env := &Environment{}
+	WithDiagnosticsOnFailure(func() bool {
+		called = true
+		return true
+	}, DiagnosticsOptions{})(env)
+
+	// Skipped without clients.
+	env.runDiagnosticsOnFailure(context.Background())
+	g.Expect(called).To(BeFalse())
+
+	_, err := env.CollectDiagnostics(context.Background(), DiagnosticsOptions{})
+	g.Expect(err).To(HaveOccurred())
+}
+
+// diagnosticsAPIServer returns a Kubernetes API stand-in serving the objects
+// collected in a diagnostics bundle. Listing events fails if failEvents is
+// true.
+func diagnosticsAPIServer(failEvents bool) *httptest.Server {
+	pods := &corev1.PodList{Items: []corev1.Pod{{
+		ObjectMeta: metav1.ObjectMeta{Name: "source-controller", Namespace: "flux-system"},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "manager"}}},
+		Status: corev1.PodStatus{
+			ContainerStatuses: []corev1.ContainerStatus{{Name: "manager", RestartCount: 1}},
+		},
+	}}}
+	lists := map[string]any{
+		"/api/v1/namespaces":                  &corev1.NamespaceList{},
+		"/api/v1/events":                      &corev1.EventList{},
+		"/api/v1/nodes":                       &corev1.NodeList{},
+		"/api/v1/namespaces/flux-system/pods": pods,
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v1/namespaces/flux-system/pods/source-controller/log" {
+			if r.URL.Query().Get("previous") == "true" {
+				fmt.Fprint(w, "panic: crashed")
+			}
+			return
+		}
+		list, ok := lists[r.URL.Path]
+		if !ok || (failEvents && r.URL.Path == "/api/v1/events") {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(list)
+	}))
+}
+
+func TestStop_diagnosticsOnFailure(t *testing.T) {
+	tests := []struct {
+		name       string
+		failEvents bool
+	}{
+		{name: "bundle collected"},
+		{name: "collection error doesn't prevent destroy", failEvents: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			srv := diagnosticsAPIServer(tt.failEvents)
+			defer srv.Close()
+			clientGo, err := kubernetes.NewForConfig(&rest.Config{Host: srv.URL})
+			g.Expect(err).ToNot(HaveOccurred())
+
+			buildDir := t.TempDir()
+			env := &Environment{
+				tf:       destroyTerraform(t, buildDir),
+				buildDir: buildDir,
+				Client:   fake.NewClientBuilder().Build(),
+				ClientGo: clientGo,
+			}
+			WithDiagnosticsOnFailure(func() bool { return true }, DiagnosticsOptions{
+				Namespaces: []string{"flux-system"},
+			})(env)
+
+			g.Expect(env.Stop(context.Background())).To(Succeed())
+			g.Expect(filepath.Join(buildDir, "destroyed")).To(BeAnExistingFile())
+
+			bundles, err := filepath.Glob(filepath.Join(buildDir, diagnosticsDir, "*"))
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(bundles).To(HaveLen(1))
+			g.Expect(filepath.Join(bundles[0], "namespaces.yaml")).To(BeAnExistingFile())
+			b, err := os.ReadFile(filepath.Join(bundles[0], "namespaces/flux-system/logs/source-controller/manager.previous.log"))
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(string(b)).To(Equal("panic: crashed"))
+			if tt.failEvents {
+				g.Expect(filepath.Join(bundles[0], "events.yaml")).ToNot(BeAnExistingFile())
+			}
+		})
+	}
+}
@@ -20,4 +20,7 @@ limitations under the License.
 // For ease of use, it also contains some helper utilities for interacting with
 // the various cloud providers for generating kubeconfig of the created cluster,
 // registry login and pushing images to the registries, etc.
+//
+// The module requires Go 1.24 or newer, the minimum version of the AWS SDK for
+// Go v2 it depends on.
 package tftestenv
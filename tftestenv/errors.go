@@ -0,0 +1,195 @@
+/*
+Copyright 2026 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tftestenv
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ErrorClass is the class of a terraform error diagnostic.
+type ErrorClass string
+
+const (
+	// ErrorClassUnknown is the class of errors that couldn't be classified.
+	ErrorClassUnknown ErrorClass = "Unknown"
+	// ErrorClassQuotaExceeded is the class of errors caused by exceeding a
+	// cloud resource quota.
+	ErrorClassQuotaExceeded ErrorClass = "QuotaExceeded"
+	// ErrorClassRateLimited is the class of errors caused by cloud API
+	// throttling.
+	ErrorClassRateLimited ErrorClass = "RateLimited"
+	// ErrorClassAuthFailure is the class of authentication and authorization
+	// errors.
+	ErrorClassAuthFailure ErrorClass = "AuthFailure"
+	// ErrorClassAlreadyExists is the class of errors caused by a resource
+	// that already exists.
+	ErrorClassAlreadyExists ErrorClass = "AlreadyExists"
+	// ErrorClassTransient is the class of temporary cloud API errors, like
+	// eventual consistency and service availability errors.
+	ErrorClassTransient ErrorClass = "Transient"
+)
+
+// Retryable returns true if an operation that failed with an error of the
+// class may succeed when it's run again.
+func (c ErrorClass) Retryable() bool {
+	return c == ErrorClassRateLimited || c == ErrorClassTransient
+}
+
+// statusCode returns a pattern matching the given HTTP status codes only in
+// the forms the cloud SDKs report them, like "StatusCode: 429", "status code
+// 503" or "Error 403", so that other numbers aren't mistaken for them.
+func statusCode(codes string) string {
+	return `(?i:status ?code:? ?|\berror |\bhttp )(?:` + codes + `)\b`
+}
+
+// errorClassPatterns are the patterns of the error diagnostics of every class,
+// in the order they are checked. Provider error codes are matched case
+// sensitively as whole tokens, phrases case insensitively.
+var errorClassPatterns = []struct {
+	class   ErrorClass
+	pattern *regexp.Regexp
+}{
+	{ErrorClassRateLimited, regexp.MustCompile(`\bThrottl\w*|\b\w*RequestLimitExceeded\b|\bTooManyRequests\b|(?i:\brate exceeded|\brate limit|too many requests)|` + statusCode(`429`))},
+	{ErrorClassQuotaExceeded, regexp.MustCompile(`\b\w*QuotaExceeded\b|\b\w*LimitExceeded\b|(?i:\bquota\b.*\bexceed|\bexceed.*\bquota\b|\blimit exceeded)`)},
+	{ErrorClassAuthFailure, regexp.MustCompile(`\bAccessDenied\w*|\bExpiredToken\w*|\bUnauthorized\w*|\bAuthorizationFailed\b|(?i:\bunauthori[sz]ed\b|\baccess denied|authentication failed|invalid credentials|permission denied)|` + statusCode(`401|403`))},
+	{ErrorClassAlreadyExists, regexp.MustCompile(`\b\w*AlreadyExists\b|(?i:already exists)|` + statusCode(`409`))},
+	{ErrorClassTransient, regexp.MustCompile(`\bInternalError\b|\bServiceUnavailable\w*|(?i:try again|\bretry later|eventual consistency|not yet available|internal server error|service unavailable|connection reset|i/o timeout|TLS handshake timeout)|` + statusCode(`500|502|503|504`))},
+}
+
+// diagnosticSnippet matches the lines of the configuration snippet terraform
+// adds to a diagnostic detail: the resource address, the source location, the
+// source lines and the values of the expression.
+var diagnosticSnippet = regexp.MustCompile(`^\s*(?:with \S+,|on \S+ line \d+.*|\d+:.*|[├│].*)$`)
+
+// classifyDiagnostic returns the class of the given error diagnostic. The
+// configuration snippet is ignored, as its line numbers and names would match
+// the patterns.
+func classifyDiagnostic(diag string) ErrorClass {
+	var lines []string
+	for _, line := range strings.Split(diag, "\n") {
+		if !diagnosticSnippet.MatchString(line) {
+			lines = append(lines, line)
+		}
+	}
+	diag = strings.Join(lines, "\n")
+
+	for _, p := range errorClassPatterns {
+		if p.pattern.MatchString(diag) {
+			return p.class
+		}
+	}
+	return ErrorClassUnknown
+}
+
+// TerraformError is a terraform command error with the error diagnostics
+// classified. Use errors.As to check the class of a failed operation.
+type TerraformError struct {
+	// Class is the class of the error. It's retryable only if all the
+	// diagnostics are retryable.
+	Class ErrorClass
+	// Diagnostics are the error diagnostics reported by terraform.
+	Diagnostics []Diagnostic
+	// Err is the underlying terraform command error.
+	Err error
+}
+
+// Diagnostic is a classified terraform error diagnostic.
+type Diagnostic struct {
+	// Class is the class of the diagnostic.
+	Class ErrorClass
+	// Summary is the summary of the diagnostic.
+	Summary string
+	// Detail is the detail of the diagnostic.
+	Detail string
+}
+
+// Error implements error.
+func (e *TerraformError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Class, e.Err)
+}
+
+// Unwrap returns the underlying terraform command error.
+func (e *TerraformError) Unwrap() error {
+	return e.Err
+}
+
+// Retryable returns true if the failed operation may succeed when it's run
+// again.
+func (e *TerraformError) Retryable() bool {
+	return e.Class.Retryable()
+}
+
+// diagnosticBorder matches the box drawing characters terraform uses around
+// diagnostics.
+var diagnosticBorder = regexp.MustCompile(`^\s*[╷│╵]\s?`)
+
+// parseDiagnostics returns the error diagnostics in the given terraform
+// output.
+func parseDiagnostics(output string) []Diagnostic {
+	var diags []Diagnostic
+	var current *Diagnostic
+	var detail []string
+	flush := func() {
+		if current != nil {
+			current.Detail = strings.TrimSpace(strings.Join(detail, "\n"))
+			current.Class = classifyDiagnostic(current.Summary + "\n" + current.Detail)
+			diags = append(diags, *current)
+		}
+		current, detail = nil, nil
+	}
+
+	for _, line := range strings.Split(output, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "╵") {
+			flush()
+			continue
+		}
+		line = diagnosticBorder.ReplaceAllString(line, "")
+		if summary, ok := strings.CutPrefix(strings.TrimSpace(line), "Error: "); ok {
+			flush()
+			current = &Diagnostic{Summary: summary}
+			continue
+		}
+		if current != nil {
+			detail = append(detail, line)
+		}
+	}
+	flush()
+	return diags
+}
+
+// classifyError returns a TerraformError with the classified diagnostics in
+// the output of the given terraform command error.
+func classifyError(err error) *TerraformError {
+	tfErr := &TerraformError{
+		Class:       ErrorClassUnknown,
+		Diagnostics: parseDiagnostics(err.Error()),
+		Err:         err,
+	}
+	// The error is retryable only if all the diagnostics are, else use the
+	// class of the first non-retryable diagnostic.
+	for _, d := range tfErr.Diagnostics {
+		if !d.Class.Retryable() {
+			tfErr.Class = d.Class
+			break
+		}
+		tfErr.Class = d.Class
+	}
+	return tfErr
+}
@@ -0,0 +1,189 @@
+/*
+Copyright 2026 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tftestenv
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+const throttledApplyOutput = `exit status 1
+
+Error: creating EKS Node Group (flux-test:default): operation error EKS: CreateNodegroup, https response error StatusCode: 429, RequestID: 1234, ThrottlingException: Rate exceeded
+
+  with module.eks.aws_eks_node_group.this,
+  on .terraform/modules/eks/main.tf line 10, in resource "aws_eks_node_group" "this":
+  10: resource "aws_eks_node_group" "this" {
+`
+
+const mixedApplyOutput = `exit status 1
+╷
+│ Error: creating IAM Role (flux-test): operation error IAM: CreateRole, https response error StatusCode: 409, EntityAlreadyExists: Role with name flux-test already exists.
+│
+│   with aws_iam_role.this,
+│   on main.tf line 1, in resource "aws_iam_role" "this":
+│    1: resource "aws_iam_role" "this" {
+│
+╵
+╷
+│ Error: waiting for EKS Cluster (flux-test) create: unexpected state 'FAILED', please try again
+╵
+`
+
+const quotaApplyOutput = `exit status 1
+╷
+│ Error: creating EC2 VPC: operation error EC2: CreateVpc, https response error StatusCode: 400, api error VpcLimitExceeded: The maximum number of VPCs has been reached.
+╵
+`
+
+const authApplyOutput = `exit status 1
+╷
+│ Error: googleapi: Error 403: Permission denied on resource project flux-test., forbidden
+╵
+`
+
+// snippetApplyOutput is a permanent error whose configuration snippet and
+// detail contain status codes, retry and quota names.
+const snippetApplyOutput = `exit status 1
+╷
+│ Error: Unsupported argument
+│
+│   with google_container_cluster.quota,
+│   on main.tf line 429, in resource "google_container_cluster" "quota":
+│  429:   max_retry = 503
+│
+│ An argument named "max_retry" is not expected here. Did you mean
+│ "quota_project"? Valid ports are 401 to 409.
+╵
+`
+
+const unavailableApplyOutput = `exit status 1
+╷
+│ Error: creating Resource Group: unexpected status code 503 from the management API
+╵
+`
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name          string
+		output        string
+		wantClass     ErrorClass
+		wantRetryable bool
+		wantDiags     int
+	}{
+		{
+			name:          "rate limited",
+			output:        throttledApplyOutput,
+			wantClass:     ErrorClassRateLimited,
+			wantRetryable: true,
+			wantDiags:     1,
+		},
+		{
+			name:      "non-retryable diagnostic wins",
+			output:    mixedApplyOutput,
+			wantClass: ErrorClassAlreadyExists,
+			wantDiags: 2,
+		},
+		{
+			name:      "quota exceeded",
+			output:    quotaApplyOutput,
+			wantClass: ErrorClassQuotaExceeded,
+			wantDiags: 1,
+		},
+		{
+			name:      "auth failure",
+			output:    authApplyOutput,
+			wantClass: ErrorClassAuthFailure,
+			wantDiags: 1,
+		},
+		{
+			name:      "numbers and names in snippet",
+			output:    snippetApplyOutput,
+			wantClass: ErrorClassUnknown,
+			wantDiags: 1,
+		},
+		{
+			name:          "status code",
+			output:        unavailableApplyOutput,
+			wantClass:     ErrorClassTransient,
+			wantRetryable: true,
+			wantDiags:     1,
+		},
+		{
+			name:      "no diagnostics",
+			output:    "exit status 1",
+			wantClass: ErrorClassUnknown,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			cmdErr := errors.New(tt.output)
+			err := fmt.Errorf("error running apply: %w", classifyError(cmdErr))
+
+			var tfErr *TerraformError
+			g.Expect(errors.As(err, &tfErr)).To(BeTrue())
+			g.Expect(tfErr.Class).To(Equal(tt.wantClass))
+			g.Expect(tfErr.Retryable()).To(Equal(tt.wantRetryable))
+			g.Expect(tfErr.Diagnostics).To(HaveLen(tt.wantDiags))
+			g.Expect(errors.Is(err, cmdErr)).To(BeTrue())
+		})
+	}
+}
+
+func TestParseDiagnostics(t *testing.T) {
+	g := NewWithT(t)
+
+	diags := parseDiagnostics(mixedApplyOutput)
+	g.Expect(diags).To(HaveLen(2))
+	g.Expect(diags[0].Summary).To(HavePrefix("creating IAM Role (flux-test)"))
+	g.Expect(diags[0].Detail).To(ContainSubstring(`on main.tf line 1, in resource "aws_iam_role" "this":`))
+	g.Expect(diags[0].Class).To(Equal(ErrorClassAlreadyExists))
+	g.Expect(diags[1].Summary).To(HavePrefix("waiting for EKS Cluster (flux-test) create"))
+	g.Expect(diags[1].Class).To(Equal(ErrorClassTransient))
+}
+
+func TestClassifyDiagnostic(t *testing.T) {
+	tests := []struct {
+		diag string
+		want ErrorClass
+	}{
+		{"Error: Invalid value\n\non main.tf line 409:\n 409:   port = 429", ErrorClassUnknown},
+		{"unsupported argument max_retry", ErrorClassUnknown},
+		{"unsupported argument quota_project", ErrorClassUnknown},
+		{"instance type t3.503 not found", ErrorClassUnknown},
+		{"https response error StatusCode: 429", ErrorClassRateLimited},
+		{"api error ThrottlingException: Rate exceeded", ErrorClassRateLimited},
+		{"Quota 'CPUS' exceeded. Limit: 24.0 in region us-east1", ErrorClassQuotaExceeded},
+		{"api error VpcLimitExceeded", ErrorClassQuotaExceeded},
+		{"googleapi: Error 403: forbidden", ErrorClassAuthFailure},
+		{"api error EntityAlreadyExists", ErrorClassAlreadyExists},
+		{"received status code 502", ErrorClassTransient},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.diag, func(t *testing.T) {
+			g := NewWithT(t)
+			g.Expect(classifyDiagnostic(tt.diag)).To(Equal(tt.want))
+		})
+	}
+}
@@ -34,6 +34,8 @@ type Options struct {
 	// DestroyOnly can be used to run the testenv in destroy only mode to
 	// perform cleanup.
 	DestroyOnly bool
+	// Tofu flag to use OpenTofu instead of terraform.
+	Tofu bool
 }
 
 var supportedProviders = []string{"aws", "azure", "gcp"}
@@ -45,9 +47,11 @@ func (o *Options) Bindflags(fs *flag.FlagSet) {
 	fs.BoolVar(&o.Existing, "existing", false, "use existing infrastructure state for debugging purposes")
 	fs.BoolVar(&o.Verbose, "verbose", false, "verbose output of the environment setup")
 	fs.BoolVar(&o.DestroyOnly, "destroy-only", false, "run in destroy-only mode and delete any existing infrastructure")
+	fs.BoolVar(&o.Tofu, "tofu", false, "use OpenTofu instead of terraform")
 }
 
-// Validate method ensures that the provider is set to one of the supported ones - aws, azure or gcp.
+// Validate method ensures that the provider is set to one of the supported
+// ones - aws, azure, gcp, local or any provider added with RegisterProvider.
 func (o *Options) Validate() error {
 	if o.Provider == "" {
 		return fmt.Errorf("-provider flag must be set to one of %v", supportedProviders)
@@ -20,6 +20,12 @@ import (
 	"context"
 	"fmt"
 	"os"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/v1/google"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	tfjson "github.com/hashicorp/terraform-json"
+	googleauth "golang.org/x/oauth2/google"
 )
 
 // CreateKubeconfigGKE constructs kubeconfig from the terraform state output at
@@ -63,21 +69,104 @@ func GetGoogleArtifactRegistryAndRepository(project, region, repositoryID string
 	return artifactRegistry, artifactRepository
 }
 
-// PushTestAppImagesGCR pushes app images that are being tested. It must be
-// called after RegistryLoginGCR to ensure the local docker client is already
-// logged in and is capable of pushing the test images.
-func PushTestAppImagesGCR(ctx context.Context, localImgs map[string]string, project, region, artifactRepoID string) (map[string]string, error) {
+// GCRAuthenticator returns an authenticator for Artifact Registry and GCR,
+// from the refreshing OAuth2 token source of the Google application default
+// credentials. Unlike RegistryLoginGCR, it needs no CLI and doesn't change the
+// docker config.
+func GCRAuthenticator(ctx context.Context) (authn.Authenticator, error) {
+	ts, err := googleauth.DefaultTokenSource(ctx, cloudPlatformScope)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Google credentials: %w", err)
+	}
+	return google.NewTokenSourceAuthenticator(ts), nil
+}
+
+// cloudPlatformScope is the OAuth2 scope of the Google Cloud APIs.
+const cloudPlatformScope = "https://www.googleapis.com/auth/cloud-platform"
+
+// PushTestAppImagesGCR pushes app images that are being tested. Without remote
+// options, like remote.WithAuth with GCRAuthenticator, it must be called after
+// RegistryLoginGCR to ensure the local docker client is already logged in and
+// is capable of pushing the test images. It returns the pushed images, keyed
+// by the names of the local images.
+func PushTestAppImagesGCR(ctx context.Context, localImgs map[string]string, project, region, artifactRepoID string, opts ...remote.Option) (map[string]PushedImage, error) {
 	// Get the repository name and construct the image names accordingly.
 	_, repo := GetGoogleArtifactRegistryAndRepository(project, region, artifactRepoID)
-	imageRepo := map[string]string{}
+	imageRepo := map[string]PushedImage{}
 
 	for name, image := range localImgs {
 		remoteImg := fmt.Sprintf("%s/%s:test", repo, name)
-		err := RetagAndPush(ctx, image, remoteImg)
+		digest, err := RetagAndPush(ctx, image, remoteImg, opts...)
 		if err != nil {
 			return nil, err
 		}
-		imageRepo[name] = remoteImg
+		imageRepo[name] = PushedImage{Ref: remoteImg, Digest: digest}
 	}
 	return imageRepo, nil
 }
+
+// Terraform outputs used by GCPProvider.
+const (
+	gcpOutputKubeconfig = "gcp_kubeconfig"
+	gcpOutputProject    = "gcp_project"
+	gcpOutputRegion     = "gcp_region"
+	gcpOutputRepoID     = "gcp_artifact_repository"
+)
+
+// GCPProvider is the Provider for GKE clusters and Artifact Registry
+// repositories. It expects the terraform outputs gcp_kubeconfig, gcp_project,
+// gcp_region and gcp_artifact_repository.
+type GCPProvider struct{}
+
+// Name implements Provider.
+func (GCPProvider) Name() string {
+	return "gcp"
+}
+
+// RequiredOutputs implements Provider.
+func (GCPProvider) RequiredOutputs(op Operation) []string {
+	if op == OperationRegistry {
+		return []string{gcpOutputProject, gcpOutputRegion, gcpOutputRepoID}
+	}
+	return []string{gcpOutputKubeconfig}
+}
+
+// CreateKubeconfig implements Provider.
+func (GCPProvider) CreateKubeconfig(ctx context.Context, state map[string]*tfjson.StateOutput, kcPath string) error {
+	kubeconfigYaml, err := stateOutputString(state, gcpOutputKubeconfig)
+	if err != nil {
+		return err
+	}
+	return CreateKubeconfigGKE(ctx, kubeconfigYaml, kcPath)
+}
+
+// RegistryLogin implements Provider.
+func (GCPProvider) RegistryLogin(ctx context.Context, state map[string]*tfjson.StateOutput) (string, error) {
+	v, err := stateOutputStrings(state, gcpOutputProject, gcpOutputRegion, gcpOutputRepoID)
+	if err != nil {
+		return "", err
+	}
+	registry, repo := GetGoogleArtifactRegistryAndRepository(v[0], v[1], v[2])
+	if err := RegistryLoginGCR(ctx, registry); err != nil {
+		return "", err
+	}
+	return repo, nil
+}
+
+// RegistryAuthenticator implements Provider.
+func (GCPProvider) RegistryAuthenticator(ctx context.Context, state map[string]*tfjson.StateOutput) (authn.Authenticator, error) {
+	return GCRAuthenticator(ctx)
+}
+
+// PushTestAppImages implements Provider.
+func (p GCPProvider) PushTestAppImages(ctx context.Context, state map[string]*tfjson.StateOutput, localImgs map[string]string) (map[string]PushedImage, error) {
+	v, err := stateOutputStrings(state, gcpOutputProject, gcpOutputRegion, gcpOutputRepoID)
+	if err != nil {
+		return nil, err
+	}
+	auth, err := p.RegistryAuthenticator(ctx, state)
+	if err != nil {
+		return nil, err
+	}
+	return PushTestAppImagesGCR(ctx, localImgs, v[0], v[1], v[2], remote.WithAuth(auth))
+}
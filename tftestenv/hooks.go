@@ -0,0 +1,155 @@
+/*
+Copyright 2026 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tftestenv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+)
+
+// destroyKubeconfigFile is the name of the kubeconfig in the build directory
+// created by Destroy to run the before destroy hooks.
+const destroyKubeconfigFile = "kubeconfig-destroy"
+
+// Hooks are functions called at defined points of the lifecycle of the
+// Environment. Any of them can be nil.
+type Hooks struct {
+	// AfterApply is called after the infrastructure is applied, before the
+	// kubeconfig is created. An error fails the environment set up.
+	AfterApply func(ctx context.Context, state map[string]*tfjson.StateOutput) error
+	// AfterReady is called after the clients of the environment are ready. An
+	// error fails the environment set up.
+	AfterReady func(ctx context.Context, env *Environment) error
+	// BeforeDestroy is called before the infrastructure is destroyed, with the
+	// clients of the environment ready. It's the place to delete the objects
+	// in the cluster that block the deletion of the infrastructure. It's also
+	// called by Destroy when a kubeconfig can be created from the state. An
+	// error doesn't prevent the destroy, it's returned along with the destroy
+	// result.
+	BeforeDestroy func(ctx context.Context, env *Environment) error
+}
+
+// WithHooks configures lifecycle hooks of the Environment. The hooks of
+// multiple calls are called in order, and their errors are aggregated.
+func WithHooks(hooks ...Hooks) EnvironmentOption {
+	return func(e *Environment) {
+		e.hooks = append(e.hooks, hooks...)
+	}
+}
+
+// WithScheme configures the scheme of the clients that Destroy creates for the
+// before destroy hooks and the cloud-backed objects cleanup. Set it to the
+// scheme passed to New, so that the hooks can use typed objects, like the Flux
+// objects to suspend or delete. It defaults to the client-go scheme. New uses
+// the scheme it's given.
+func WithScheme(scheme *runtime.Scheme) EnvironmentOption {
+	return func(e *Environment) {
+		e.scheme = scheme
+	}
+}
+
+// destroyScheme returns the scheme of the clients created by Destroy.
+func (env *Environment) destroyScheme() *runtime.Scheme {
+	if env.scheme == nil {
+		return clientgoscheme.Scheme
+	}
+	return env.scheme
+}
+
+// runAfterApplyHooks calls the after apply hooks.
+func (env *Environment) runAfterApplyHooks(ctx context.Context, state map[string]*tfjson.StateOutput) error {
+	var errs []error
+	for _, h := range env.hooks {
+		if h.AfterApply != nil {
+			errs = append(errs, h.AfterApply(ctx, state))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("after apply hook failed: %w", err)
+	}
+	return nil
+}
+
+// runAfterReadyHooks calls the after ready hooks.
+func (env *Environment) runAfterReadyHooks(ctx context.Context) error {
+	var errs []error
+	for _, h := range env.hooks {
+		if h.AfterReady != nil {
+			errs = append(errs, h.AfterReady(ctx, env))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("after ready hook failed: %w", err)
+	}
+	return nil
+}
+
+// runBeforeDestroyHooks calls the before destroy hooks if the clients of the
+// environment are ready.
+func (env *Environment) runBeforeDestroyHooks(ctx context.Context) error {
+	if env.Client == nil {
+		return nil
+	}
+
+	var errs []error
+	for _, h := range env.hooks {
+		if h.BeforeDestroy != nil {
+			errs = append(errs, h.BeforeDestroy(ctx, env))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("before destroy hook failed: %w", err)
+	}
+	return nil
+}
+
+// hasBeforeDestroyHooks returns true if any before destroy hook is configured.
+func (env *Environment) hasBeforeDestroyHooks() bool {
+	for _, h := range env.hooks {
+		if h.BeforeDestroy != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// configureForDestroy configures the clients of an Environment created by
+// Destroy from the terraform state, so that the before destroy hooks and the
+// cloud-backed objects cleanup can run. It's a no-op if no kubeconfig can be
+// created.
+func (env *Environment) configureForDestroy(ctx context.Context) {
+	if (!env.hasBeforeDestroyHooks() && !env.cleanup) || env.CreateKubeconfig == nil {
+		return
+	}
+	state, err := env.tf.Show(ctx)
+	if err != nil || state.Values == nil {
+		env.phaseLogger("destroy").Info("No terraform state outputs found, skipping before destroy hooks and cleanup")
+		return
+	}
+	kubeconfigPath := filepath.Join(env.buildDir, destroyKubeconfigFile)
+	if err := env.configure(ctx, env.destroyScheme(), state.Values.Outputs, kubeconfigPath); err != nil {
+		env.phaseLogger("destroy").Info("Failed to configure clients, skipping before destroy hooks and cleanup", "error", err.Error())
+		env.Client = nil
+		env.ClientGo = nil
+	}
+}
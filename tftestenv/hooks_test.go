@@ -0,0 +1,89 @@
+/*
+Copyright 2026 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tftestenv
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestHooks(t *testing.T) {
+	g := NewWithT(t)
+
+	var calls []string
+	env := &Environment{}
+	WithHooks(
+		Hooks{
+			AfterApply: func(ctx context.Context, state map[string]*tfjson.StateOutput) error {
+				calls = append(calls, "after-apply-1")
+				return errors.New("foo")
+			},
+			BeforeDestroy: func(ctx context.Context, env *Environment) error {
+				calls = append(calls, "before-destroy-1")
+				return nil
+			},
+		},
+		Hooks{
+			AfterApply: func(ctx context.Context, state map[string]*tfjson.StateOutput) error {
+				calls = append(calls, "after-apply-2")
+				return errors.New("bar")
+			},
+			AfterReady: func(ctx context.Context, env *Environment) error {
+				calls = append(calls, "after-ready-2")
+				return nil
+			},
+			BeforeDestroy: func(ctx context.Context, env *Environment) error {
+				calls = append(calls, "before-destroy-2")
+				return errors.New("baz")
+			},
+		},
+	)(env)
+
+	// All the hooks are called and their errors aggregated.
+	err := env.runAfterApplyHooks(context.TODO(), nil)
+	g.Expect(err).To(MatchError(ContainSubstring("foo")))
+	g.Expect(err).To(MatchError(ContainSubstring("bar")))
+	g.Expect(env.runAfterReadyHooks(context.TODO())).To(Succeed())
+	g.Expect(calls).To(Equal([]string{"after-apply-1", "after-apply-2", "after-ready-2"}))
+
+	// Before destroy hooks are skipped without clients.
+	calls = nil
+	g.Expect(env.runBeforeDestroyHooks(context.TODO())).To(Succeed())
+	g.Expect(calls).To(BeEmpty())
+
+	env.Client = fake.NewClientBuilder().Build()
+	g.Expect(env.runBeforeDestroyHooks(context.TODO())).To(MatchError(ContainSubstring("baz")))
+	g.Expect(calls).To(Equal([]string{"before-destroy-1", "before-destroy-2"}))
+}
+
+func TestDestroyScheme(t *testing.T) {
+	g := NewWithT(t)
+
+	env := &Environment{}
+	g.Expect(env.destroyScheme()).To(BeIdenticalTo(clientgoscheme.Scheme))
+
+	scheme := runtime.NewScheme()
+	WithScheme(scheme)(env)
+	g.Expect(env.destroyScheme()).To(BeIdenticalTo(scheme))
+}
@@ -0,0 +1,184 @@
+/*
+Copyright 2026 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tftestenv
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http/httptest"
+	"os"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	tfjson "github.com/hashicorp/terraform-json"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+)
+
+// Terraform outputs used by LocalProvider.
+const (
+	localOutputKubeconfig  = "local_kubeconfig"
+	localOutputRegistryURL = "local_registry_url"
+)
+
+// CreateKubeconfigLocal constructs kubeconfig for a local cluster from the
+// terraform state output at the given kubeconfig path.
+func CreateKubeconfigLocal(ctx context.Context, kubeconfigYaml string, kcPath string) error {
+	f, err := os.Create(kcPath)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprint(f, kubeconfigYaml)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// PushTestAppImagesLocal pushes app images that are being tested to the local
+// registry. The local registry requires no login. It returns the pushed images,
+// keyed by the names of the local images.
+func PushTestAppImagesLocal(ctx context.Context, localImgs map[string]string, registryURL string, opts ...remote.Option) (map[string]PushedImage, error) {
+	imageRepo := map[string]PushedImage{}
+
+	for name, image := range localImgs {
+		remoteImg := fmt.Sprintf("%s/%s:test", registryURL, name)
+		digest, err := RetagAndPush(ctx, image, remoteImg, opts...)
+		if err != nil {
+			return nil, err
+		}
+		imageRepo[name] = PushedImage{Ref: remoteImg, Digest: digest}
+	}
+	return imageRepo, nil
+}
+
+// LocalProvider is the Provider for local clusters and registries, created
+// by the tf-modules/local/kind terraform module or by an envtest control plane
+// with WithEnvtest. It expects the terraform outputs local_kubeconfig and
+// local_registry_url.
+type LocalProvider struct{}
+
+// Name implements Provider.
+func (LocalProvider) Name() string {
+	return "local"
+}
+
+// RequiredOutputs implements Provider.
+func (LocalProvider) RequiredOutputs(op Operation) []string {
+	if op == OperationRegistry {
+		return []string{localOutputRegistryURL}
+	}
+	return []string{localOutputKubeconfig}
+}
+
+// CreateKubeconfig implements Provider.
+func (LocalProvider) CreateKubeconfig(ctx context.Context, state map[string]*tfjson.StateOutput, kcPath string) error {
+	kubeconfigYaml, err := stateOutputString(state, localOutputKubeconfig)
+	if err != nil {
+		return err
+	}
+	return CreateKubeconfigLocal(ctx, kubeconfigYaml, kcPath)
+}
+
+// RegistryLogin implements Provider. The local registry requires no login, the
+// registry URL is returned as is.
+func (LocalProvider) RegistryLogin(ctx context.Context, state map[string]*tfjson.StateOutput) (string, error) {
+	return stateOutputString(state, localOutputRegistryURL)
+}
+
+// RegistryAuthenticator implements Provider. The local registry requires no
+// authentication.
+func (LocalProvider) RegistryAuthenticator(ctx context.Context, state map[string]*tfjson.StateOutput) (authn.Authenticator, error) {
+	return authn.Anonymous, nil
+}
+
+// PushTestAppImages implements Provider.
+func (LocalProvider) PushTestAppImages(ctx context.Context, state map[string]*tfjson.StateOutput, localImgs map[string]string) (map[string]PushedImage, error) {
+	registryURL, err := stateOutputString(state, localOutputRegistryURL)
+	if err != nil {
+		return nil, err
+	}
+	return PushTestAppImagesLocal(ctx, localImgs, registryURL, remote.WithAuth(authn.Anonymous))
+}
+
+// WithEnvtest configures the Environment to start the given envtest control
+// plane and an in-process OCI registry instead of running terraform. The
+// terraform state outputs are emulated in the shape expected by LocalProvider,
+// which is used unless another way of creating the kubeconfig is configured.
+func WithEnvtest(te *envtest.Environment) EnvironmentOption {
+	return func(e *Environment) {
+		e.envtest = te
+	}
+}
+
+// startLocal starts the envtest control plane and the local registry, and
+// configures the Environment with them.
+func (env *Environment) startLocal(ctx context.Context, scheme *runtime.Scheme, kubeconfigPath string) error {
+	env.phaseLogger("envtest").Info("Starting envtest control plane")
+	if _, err := env.envtest.Start(); err != nil {
+		return fmt.Errorf("failed to start envtest: %w", err)
+	}
+	user, err := env.envtest.AddUser(envtest.User{Name: "tftestenv-admin", Groups: []string{"system:masters"}}, nil)
+	if err != nil {
+		return fmt.Errorf("failed to add envtest user: %w", err)
+	}
+	kubeconfigYaml, err := user.KubeConfig()
+	if err != nil {
+		return fmt.Errorf("failed to get envtest kubeconfig: %w", err)
+	}
+
+	env.phaseLogger("envtest").Info("Starting local registry")
+	env.registry = httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+
+	env.localOutputs = map[string]*tfjson.StateOutput{
+		localOutputKubeconfig:  {Value: string(kubeconfigYaml), Sensitive: true},
+		localOutputRegistryURL: {Value: strings.TrimPrefix(env.registry.URL, "http://")},
+	}
+
+	if env.provider == nil {
+		env.provider = LocalProvider{}
+	}
+	if env.CreateKubeconfig == nil {
+		env.CreateKubeconfig = env.provider.CreateKubeconfig
+	}
+	if err := env.runAfterApplyHooks(ctx, env.localOutputs); err != nil {
+		return err
+	}
+	if err := env.configure(ctx, scheme, env.localOutputs, kubeconfigPath); err != nil {
+		return err
+	}
+	if err := env.waitReady(ctx); err != nil {
+		return err
+	}
+	return env.runAfterReadyHooks(ctx)
+}
+
+// stopLocal stops the local registry and the envtest control plane.
+func (env *Environment) stopLocal() error {
+	env.phaseLogger("envtest").Info("Stopping local environment...")
+	if env.registry != nil {
+		env.registry.Close()
+	}
+	if err := env.envtest.Stop(); err != nil {
+		return fmt.Errorf("could not stop envtest: %w", err)
+	}
+	return nil
+}
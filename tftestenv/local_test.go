@@ -0,0 +1,90 @@
+/*
+Copyright 2026 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tftestenv
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	tfjson "github.com/hashicorp/terraform-json"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+)
+
+func TestLocalProviderRequiredOutputs(t *testing.T) {
+	g := NewWithT(t)
+
+	p := LocalProvider{}
+	g.Expect(p.RequiredOutputs(OperationKubeconfig)).To(Equal([]string{"local_kubeconfig"}))
+	g.Expect(p.RequiredOutputs(OperationRegistry)).To(Equal([]string{"local_registry_url"}))
+}
+
+func TestLocalProviderCreateKubeconfig(t *testing.T) {
+	g := NewWithT(t)
+
+	kubeconfigYaml := "apiVersion: v1\nkind: Config\n"
+	kcPath := filepath.Join(t.TempDir(), "kubeconfig")
+
+	state := map[string]*tfjson.StateOutput{
+		"local_kubeconfig": {Value: kubeconfigYaml, Sensitive: true},
+	}
+	g.Expect(LocalProvider{}.CreateKubeconfig(context.TODO(), state, kcPath)).To(Succeed())
+	b, err := os.ReadFile(kcPath)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(string(b)).To(Equal(kubeconfigYaml))
+
+	err = LocalProvider{}.CreateKubeconfig(context.TODO(), map[string]*tfjson.StateOutput{}, kcPath)
+	g.Expect(err).To(MatchError(ContainSubstring("local_kubeconfig")))
+}
+
+func TestLocalProviderRegistryAuthenticator(t *testing.T) {
+	g := NewWithT(t)
+
+	auth, err := LocalProvider{}.RegistryAuthenticator(context.TODO(), nil)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(auth).To(Equal(authn.Anonymous))
+}
+
+func TestNew_envtest(t *testing.T) {
+	if os.Getenv("KUBEBUILDER_ASSETS") == "" {
+		t.Skip("KUBEBUILDER_ASSETS is not set, skipping envtest round trip")
+	}
+	g := NewWithT(t)
+	t.Chdir(t.TempDir())
+
+	ctx := context.TODO()
+	env, err := New(ctx, clientgoscheme.Scheme, "", "kubeconfig", WithEnvtest(&envtest.Environment{}))
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(env.Provider()).To(Equal(LocalProvider{}))
+
+	state, err := env.StateOutput(ctx)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(ValidateOutputs(env.Provider(), OperationKubeconfig, state)).To(Succeed())
+	g.Expect(ValidateOutputs(env.Provider(), OperationRegistry, state)).To(Succeed())
+	g.Expect("kubeconfig").To(BeARegularFile())
+
+	var namespaces corev1.NamespaceList
+	g.Expect(env.Client.List(ctx, &namespaces)).To(Succeed())
+	g.Expect(namespaces.Items).ToNot(BeEmpty())
+
+	g.Expect(env.Stop(ctx)).To(Succeed())
+}
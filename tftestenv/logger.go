@@ -0,0 +1,86 @@
+/*
+Copyright 2026 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tftestenv
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/klog/v2/klogr"
+	runtimeLog "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// WithLogger configures the logger of the Environment. It's also passed in the
+// context to the hooks and the providers, and used as the controller-runtime
+// logger if none is set. It defaults to a klog logger.
+func WithLogger(logger logr.Logger) EnvironmentOption {
+	return func(e *Environment) {
+		e.logger = logger
+	}
+}
+
+// Logger returns the logger of the Environment. Pass it to the helpers of the
+// package, like RunCommand and the registry helpers, with Context or
+// logr.NewContext. Without a logger in their context, the helpers log to klog.
+func (env *Environment) Logger() logr.Logger {
+	if env.logger.GetSink() == nil {
+		return klogr.New()
+	}
+	return env.logger
+}
+
+// setUpLogger defaults the logger of the Environment, sets it as the
+// controller-runtime logger if none is set and returns a context carrying it.
+func (env *Environment) setUpLogger(ctx context.Context) context.Context {
+	env.logger = env.Logger()
+	setRuntimeLogger(env.logger)
+	return logr.NewContext(ctx, env.logger)
+}
+
+// phaseLogger returns the logger of the Environment for the given phase.
+func (env *Environment) phaseLogger(phase string) logr.Logger {
+	logger := env.Logger().WithValues("phase", phase)
+	if env.provider != nil {
+		logger = logger.WithValues("provider", env.provider.Name())
+	}
+	return logger
+}
+
+// logPhaseDone logs the completion of the given phase along with its duration
+// since start.
+func (env *Environment) logPhaseDone(phase string, start time.Time) {
+	env.phaseLogger(phase).Info("phase completed", "duration", time.Since(start).Round(time.Millisecond))
+}
+
+// setRuntimeLogger sets the controller-runtime logger if it isn't set yet. The
+// controller-runtime logger is a delegating sink that only creates delegating
+// children until a logger is set.
+func setRuntimeLogger(logger logr.Logger) {
+	if _, unset := runtimeLog.Log.GetSink().WithName("tftestenv").(*runtimeLog.DelegatingLogSink); unset {
+		runtimeLog.SetLogger(logger)
+	}
+}
+
+// loggerFrom returns the logger used by the package helpers: the logger of the
+// given context, else a klog logger.
+func loggerFrom(ctx context.Context) logr.Logger {
+	if logger, err := logr.FromContext(ctx); err == nil {
+		return logger
+	}
+	return klogr.New()
+}
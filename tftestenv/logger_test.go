@@ -0,0 +1,54 @@
+/*
+Copyright 2026 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tftestenv
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/go-logr/logr/funcr"
+	. "github.com/onsi/gomega"
+)
+
+func TestLogger(t *testing.T) {
+	g := NewWithT(t)
+
+	var lines []string
+	logger := funcr.New(func(prefix, args string) {
+		lines = append(lines, args)
+	}, funcr.Options{})
+
+	env := &Environment{}
+	g.Expect(env.Logger().GetSink()).ToNot(BeNil())
+
+	WithLogger(logger)(env)
+	WithProvider(LocalProvider{})(env)
+	ctx := logr.NewContext(context.Background(), env.Logger())
+	g.Expect(loggerFrom(ctx)).To(Equal(logger))
+
+	env.logPhaseDone("apply", time.Now())
+	g.Expect(lines).To(HaveLen(1))
+	g.Expect(lines[0]).To(ContainSubstring(`"phase"="apply"`))
+	g.Expect(lines[0]).To(ContainSubstring(`"provider"="local"`))
+	g.Expect(lines[0]).To(ContainSubstring(`"duration"=`))
+
+	_, err := logr.FromContext(context.Background())
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(loggerFrom(context.Background()).GetSink()).ToNot(BeNil())
+}
@@ -0,0 +1,217 @@
+/*
+Copyright 2026 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tftestenv
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+const (
+	// logsDir is the name of the directory in the build directory with the
+	// output logs of the phases.
+	logsDir = "logs"
+	// commandsPhase is the name of the log file of the commands run with
+	// RunCommand.
+	commandsPhase = "commands"
+	// logTimeLayout is the layout of the timestamp of every line in the log
+	// files.
+	logTimeLayout = "2006-01-02T15:04:05.000Z07:00"
+)
+
+// commandLogKey is the context key of the commandLog.
+type commandLogKey struct{}
+
+// commandLog configures RunCommand to tee the command output to a log file.
+type commandLog struct {
+	// path is the path of the log file.
+	path string
+	// verbose enables the line-prefixed console output.
+	verbose bool
+}
+
+// Context returns a context carrying the logger of the Environment and the
+// configuration to tee the output of the commands to build/logs/commands.log.
+// Pass it to RunCommand and the registry helpers of the package. The hooks
+// receive such a context.
+func (env *Environment) Context(ctx context.Context) context.Context {
+	ctx = logr.NewContext(ctx, env.Logger())
+	if env.buildDir == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, commandLogKey{}, commandLog{
+		path:    filepath.Join(env.buildDir, logsDir, commandsPhase+".log"),
+		verbose: env.verbose,
+	})
+}
+
+// LogsDir returns the directory with the output logs of the phases, like
+// apply.log and destroy.log. CI can upload it as artifact after a failure.
+func (env *Environment) LogsDir() string {
+	return filepath.Join(env.buildDir, logsDir)
+}
+
+// phaseOutput tees the terraform stdout and stderr to the log file of the
+// given phase in the logs directory, and to the console with a line prefix if
+// verbose. The returned function stops it, and must be called before running
+// commands, like show, whose output shouldn't be logged.
+func (env *Environment) phaseOutput(phase string) func() {
+	var writers []io.Writer
+	var closers []io.Closer
+	if env.buildDir != "" {
+		f, err := openLogFile(filepath.Join(env.LogsDir(), phase+".log"))
+		if err != nil {
+			env.phaseLogger(phase).Error(err, "Failed to open log file")
+		} else {
+			w := newLineWriter(f, timestampPrefix)
+			writers = append(writers, w)
+			closers = append(closers, w, f)
+		}
+	}
+	if env.verbose {
+		w := newLineWriter(os.Stdout, staticPrefix(fmt.Sprintf("[%s] ", phase)))
+		writers = append(writers, w)
+		closers = append(closers, w)
+	}
+	if len(writers) == 0 {
+		return func() {}
+	}
+
+	w := io.MultiWriter(writers...)
+	env.tf.SetStdout(w)
+	env.tf.SetStderr(w)
+	return func() {
+		env.tf.SetStdout(io.Discard)
+		env.tf.SetStderr(io.Discard)
+		for _, c := range closers {
+			c.Close()
+		}
+	}
+}
+
+// commandOutput returns the writers to tee the output of a command to,
+// according to the commandLog in the context, and a function to close them.
+func commandOutput(ctx context.Context, attachConsole bool) ([]io.Writer, func()) {
+	cl, ok := ctx.Value(commandLogKey{}).(commandLog)
+	if !ok {
+		return nil, func() {}
+	}
+
+	var writers []io.Writer
+	var closers []io.Closer
+	f, err := openLogFile(cl.path)
+	if err != nil {
+		loggerFrom(ctx).Error(err, "Failed to open log file")
+	} else {
+		w := newLineWriter(f, timestampPrefix)
+		writers = append(writers, w)
+		closers = append(closers, w, f)
+	}
+	// The console gets the raw output when attached.
+	if cl.verbose && !attachConsole {
+		w := newLineWriter(os.Stdout, staticPrefix(fmt.Sprintf("[%s] ", commandsPhase)))
+		writers = append(writers, w)
+		closers = append(closers, w)
+	}
+	return writers, func() {
+		for _, c := range closers {
+			c.Close()
+		}
+	}
+}
+
+// openLogFile opens the given log file for appending, creating it and its
+// directory if needed.
+func openLogFile(path string) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return nil, err
+	}
+	return os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+}
+
+// timestampPrefix returns the current time as a log line prefix.
+func timestampPrefix() string {
+	return time.Now().Format(logTimeLayout) + " "
+}
+
+// staticPrefix returns a log line prefix function returning the given prefix.
+func staticPrefix(prefix string) func() string {
+	return func() string {
+		return prefix
+	}
+}
+
+// lineWriter writes every line written to it to the underlying writer with a
+// prefix. Partial lines are buffered until they're complete or the writer is
+// closed.
+type lineWriter struct {
+	mu     sync.Mutex
+	w      io.Writer
+	prefix func() string
+	buf    []byte
+}
+
+// newLineWriter returns a lineWriter writing to w with the given prefix.
+func newLineWriter(w io.Writer, prefix func() string) *lineWriter {
+	return &lineWriter{w: w, prefix: prefix}
+}
+
+// Write implements io.Writer.
+func (lw *lineWriter) Write(p []byte) (int, error) {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+
+	lw.buf = append(lw.buf, p...)
+	for {
+		i := bytes.IndexByte(lw.buf, '\n')
+		if i < 0 {
+			break
+		}
+		if err := lw.writeLine(lw.buf[:i+1]); err != nil {
+			return len(p), err
+		}
+		lw.buf = lw.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// Close writes the buffered partial line, if any.
+func (lw *lineWriter) Close() error {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+
+	if len(lw.buf) == 0 {
+		return nil
+	}
+	err := lw.writeLine(append(lw.buf, '\n'))
+	lw.buf = nil
+	return err
+}
+
+// writeLine writes the given line with the prefix in a single write.
+func (lw *lineWriter) writeLine(line []byte) error {
+	_, err := lw.w.Write(append([]byte(lw.prefix()), line...))
+	return err
+}
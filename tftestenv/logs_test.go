@@ -0,0 +1,66 @@
+/*
+Copyright 2026 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tftestenv
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestLineWriter(t *testing.T) {
+	g := NewWithT(t)
+
+	var buf bytes.Buffer
+	w := newLineWriter(&buf, staticPrefix("[apply] "))
+	_, err := w.Write([]byte("foo\nba"))
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(buf.String()).To(Equal("[apply] foo\n"))
+
+	_, err = w.Write([]byte("r\nbaz"))
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(buf.String()).To(Equal("[apply] foo\n[apply] bar\n"))
+
+	g.Expect(w.Close()).To(Succeed())
+	g.Expect(buf.String()).To(Equal("[apply] foo\n[apply] bar\n[apply] baz\n"))
+}
+
+func TestRunCommand_commandLog(t *testing.T) {
+	g := NewWithT(t)
+
+	env := &Environment{buildDir: t.TempDir()}
+	ctx := env.Context(context.Background())
+	g.Expect(RunCommand(ctx, "./", "echo foo; echo bar >&2", RunCommandOptions{})).To(Succeed())
+
+	b, err := os.ReadFile(filepath.Join(env.LogsDir(), "commands.log"))
+	g.Expect(err).ToNot(HaveOccurred())
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	g.Expect(lines).To(HaveLen(2))
+	g.Expect(lines).To(ContainElement(HaveSuffix(" foo")))
+	g.Expect(lines).To(ContainElement(HaveSuffix(" bar")))
+
+	// Without a command log in the context, nothing is written.
+	g.Expect(RunCommand(context.Background(), "./", "echo baz", RunCommandOptions{})).To(Succeed())
+	b, err = os.ReadFile(filepath.Join(env.LogsDir(), "commands.log"))
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(string(b)).ToNot(ContainSubstring("baz"))
+}
@@ -0,0 +1,450 @@
+/*
+Copyright 2026 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tftestenv
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/wait"
+	kyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/cli-utils/pkg/kstatus/status"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/kustomize/api/krusty"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+)
+
+const (
+	// defaultFieldManager is the field manager of the server-side apply when
+	// none is configured.
+	defaultFieldManager = "tftestenv"
+	// defaultApplyTimeout is the time budget for applying the objects and
+	// waiting for them to become Current when none is configured.
+	defaultApplyTimeout = 5 * time.Minute
+	// applyPollInterval is the interval at which the status of the applied
+	// objects is checked.
+	applyPollInterval = 2 * time.Second
+	// inventoryKey is the key of the inventory ConfigMap data with the
+	// applied objects.
+	inventoryKey = "objects"
+)
+
+// ManifestSource provides the Kubernetes objects to apply.
+type ManifestSource func() ([]*unstructured.Unstructured, error)
+
+// ManifestsFromDir returns a ManifestSource reading the YAML files in the
+// given directory and its subdirectories.
+func ManifestsFromDir(dir string) ManifestSource {
+	return ManifestsFromFS(os.DirFS(dir))
+}
+
+// ManifestsFromFS returns a ManifestSource reading the YAML files in the
+// given file system. Files are read in lexical order, and may contain
+// multiple YAML documents.
+func ManifestsFromFS(fsys fs.FS) ManifestSource {
+	return func() ([]*unstructured.Unstructured, error) {
+		var objects []*unstructured.Unstructured
+		err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				return nil
+			}
+			if ext := path.Ext(p); ext != ".yaml" && ext != ".yml" {
+				return nil
+			}
+			b, err := fs.ReadFile(fsys, p)
+			if err != nil {
+				return err
+			}
+			objs, err := decodeManifests(b)
+			if err != nil {
+				return fmt.Errorf("failed to decode %s: %w", p, err)
+			}
+			objects = append(objects, objs...)
+			return nil
+		})
+		return objects, err
+	}
+}
+
+// ManifestsFromKustomization returns a ManifestSource building the
+// kustomization in the given directory.
+func ManifestsFromKustomization(dir string) ManifestSource {
+	return func() ([]*unstructured.Unstructured, error) {
+		k := krusty.MakeKustomizer(krusty.MakeDefaultOptions())
+		resources, err := k.Run(filesys.MakeFsOnDisk(), dir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build kustomization %s: %w", dir, err)
+		}
+		b, err := resources.AsYaml()
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode kustomization %s: %w", dir, err)
+		}
+		return decodeManifests(b)
+	}
+}
+
+// ApplyOptions configures ApplyManifests.
+type ApplyOptions struct {
+	// FieldManager is the field manager of the server-side apply. Defaults
+	// to tftestenv.
+	FieldManager string
+	// Timeout is the time budget for applying the objects, including waiting
+	// for the CustomResourceDefinitions to be established, and for waiting
+	// for them to become Current. Defaults to 5 minutes.
+	Timeout time.Duration
+	// Inventory is the name of the ConfigMap recording the applied objects.
+	// When set, the objects of the previous apply with the same inventory
+	// that aren't part of the manifests anymore are deleted.
+	Inventory string
+	// InventoryNamespace is the namespace of the inventory ConfigMap.
+	// Defaults to default.
+	InventoryNamespace string
+}
+
+// ObjectStatus is the kstatus status of an applied object.
+type ObjectStatus struct {
+	// Object identifies the object as Kind/namespace/name.
+	Object string
+	// Status is the kstatus status of the object.
+	Status status.Status
+	// Message describes the status.
+	Message string
+}
+
+// ApplyReport is the status of the objects applied by ApplyManifests.
+type ApplyReport []ObjectStatus
+
+// String returns the objects that aren't Current with their status.
+func (r ApplyReport) String() string {
+	var pending []string
+	for _, s := range r {
+		if s.Status != status.CurrentStatus {
+			pending = append(pending, fmt.Sprintf("%s: %s: %s", s.Object, s.Status, s.Message))
+		}
+	}
+	return strings.Join(pending, "\n")
+}
+
+// ApplyManifests server-side applies the objects of the given source with the
+// client of the Environment and waits for all of them to be Current according
+// to kstatus. CustomResourceDefinitions and Namespaces are applied first, and
+// the other objects once the definitions are established. On
+// timeout, the returned report has the status of every object. If an
+// inventory is configured, the objects of the previous apply that are no
+// longer part of the manifests are deleted.
+func (env *Environment) ApplyManifests(ctx context.Context, source ManifestSource, opts ApplyOptions) (ApplyReport, error) {
+	objects, err := source()
+	if err != nil {
+		return nil, err
+	}
+	env.phaseLogger("apply-manifests").Info("Applying manifests", "objects", len(objects))
+	return applyManifests(ctx, env.Client, objects, opts)
+}
+
+// applyManifests applies, prunes and waits for the given objects.
+func applyManifests(ctx context.Context, c client.Client, objects []*unstructured.Unstructured, opts ApplyOptions) (ApplyReport, error) {
+	if opts.FieldManager == "" {
+		opts.FieldManager = defaultFieldManager
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = defaultApplyTimeout
+	}
+	if opts.InventoryNamespace == "" {
+		opts.InventoryNamespace = metav1.NamespaceDefault
+	}
+
+	// Share the budget across all the steps.
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	// Apply the CustomResourceDefinitions and Namespaces first, and wait for
+	// the definitions to be established before applying their custom
+	// resources.
+	sortManifests(objects)
+	split := 0
+	for split < len(objects) && (objects[split].GetKind() == crdKind || objects[split].GetKind() == "Namespace") {
+		split++
+	}
+	definitions, others := objects[:split], objects[split:]
+	for _, obj := range definitions {
+		if err := c.Patch(ctx, obj, client.Apply, client.FieldOwner(opts.FieldManager), client.ForceOwnership); err != nil {
+			return nil, fmt.Errorf("failed to apply %s: %w", objectID(obj), err)
+		}
+	}
+	if err := waitEstablished(ctx, c, definitions); err != nil {
+		return nil, err
+	}
+	if err := applyObjects(ctx, c, others, opts); err != nil {
+		return nil, err
+	}
+
+	if opts.Inventory != "" {
+		if err := pruneInventory(ctx, c, objects, opts); err != nil {
+			return nil, err
+		}
+	}
+
+	return waitCurrent(ctx, c, objects)
+}
+
+// waitEstablished waits for the given CustomResourceDefinitions to be
+// established until the context is done, and resets the RESTMapper of the
+// client so that their kinds are discovered.
+func waitEstablished(ctx context.Context, c client.Client, objects []*unstructured.Unstructured) error {
+	var crds []*unstructured.Unstructured
+	for _, obj := range objects {
+		if obj.GetKind() == crdKind {
+			crds = append(crds, obj)
+		}
+	}
+	if len(crds) == 0 {
+		return nil
+	}
+
+	var pending []string
+	err := wait.PollImmediateUntilWithContext(ctx, applyPollInterval, func(ctx context.Context) (bool, error) {
+		pending = pending[:0]
+		for _, crd := range crds {
+			u := &unstructured.Unstructured{}
+			u.SetGroupVersionKind(crd.GroupVersionKind())
+			if err := c.Get(ctx, client.ObjectKeyFromObject(crd), u); err != nil {
+				return false, client.IgnoreNotFound(err)
+			}
+			if ok, err := ConditionTrue("Established")(u); err != nil || !ok {
+				pending = append(pending, crd.GetName())
+			}
+		}
+		return len(pending) == 0, nil
+	})
+	if err != nil {
+		return fmt.Errorf("timed out waiting for CustomResourceDefinitions to be established: %s", strings.Join(pending, ", "))
+	}
+
+	if m, ok := c.RESTMapper().(meta.ResettableRESTMapper); ok {
+		m.Reset()
+	}
+	return nil
+}
+
+// applyObjects applies the given objects. The objects whose kind isn't known
+// yet by the RESTMapper of the client are retried until the context is done,
+// as the mapper may have to reload the kinds of new CustomResourceDefinitions.
+func applyObjects(ctx context.Context, c client.Client, objects []*unstructured.Unstructured, opts ApplyOptions) error {
+	var lastErr error
+	err := wait.PollImmediateUntilWithContext(ctx, applyPollInterval, func(ctx context.Context) (bool, error) {
+		var remaining []*unstructured.Unstructured
+		for _, obj := range objects {
+			err := c.Patch(ctx, obj, client.Apply, client.FieldOwner(opts.FieldManager), client.ForceOwnership)
+			if meta.IsNoMatchError(err) {
+				lastErr = fmt.Errorf("failed to apply %s: %w", objectID(obj), err)
+				remaining = append(remaining, obj)
+				continue
+			}
+			if err != nil {
+				return false, fmt.Errorf("failed to apply %s: %w", objectID(obj), err)
+			}
+		}
+		objects = remaining
+		return len(objects) == 0, nil
+	})
+	if err != nil && lastErr != nil && errors.Is(err, wait.ErrWaitTimeout) {
+		return lastErr
+	}
+	return err
+}
+
+// waitCurrent waits for the given objects to be Current until the context is
+// done and returns their status.
+func waitCurrent(ctx context.Context, c client.Client, objects []*unstructured.Unstructured) (ApplyReport, error) {
+	var report ApplyReport
+	err := wait.PollImmediateUntilWithContext(ctx, applyPollInterval, func(ctx context.Context) (bool, error) {
+		report = make(ApplyReport, 0, len(objects))
+		current := true
+		for _, obj := range objects {
+			s := objectStatus(ctx, c, obj)
+			current = current && s.Status == status.CurrentStatus
+			report = append(report, s)
+		}
+		return current, nil
+	})
+	if err != nil {
+		return report, fmt.Errorf("timed out waiting for objects to be Current:\n%s", report)
+	}
+	return report, nil
+}
+
+// objectStatus returns the kstatus status of the given object in the cluster.
+func objectStatus(ctx context.Context, c client.Client, obj *unstructured.Unstructured) ObjectStatus {
+	s := ObjectStatus{Object: objectID(obj)}
+	u := &unstructured.Unstructured{}
+	u.SetGroupVersionKind(obj.GroupVersionKind())
+	if err := c.Get(ctx, client.ObjectKeyFromObject(obj), u); err != nil {
+		s.Status, s.Message = status.UnknownStatus, err.Error()
+		if apierrors.IsNotFound(err) {
+			s.Status = status.NotFoundStatus
+		}
+		return s
+	}
+	result, err := status.Compute(u)
+	if err != nil {
+		s.Status, s.Message = status.UnknownStatus, err.Error()
+		return s
+	}
+	s.Status, s.Message = result.Status, result.Message
+	return s
+}
+
+// pruneInventory deletes the objects of the previous apply recorded in the
+// inventory that aren't part of the given objects, and records the given
+// objects in the inventory.
+func pruneInventory(ctx context.Context, c client.Client, objects []*unstructured.Unstructured, opts ApplyOptions) error {
+	key := client.ObjectKey{Namespace: opts.InventoryNamespace, Name: opts.Inventory}
+	cm := &corev1.ConfigMap{}
+	err := c.Get(ctx, key, cm)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to get inventory %s: %w", key, err)
+	}
+	exists := err == nil
+
+	current := make(map[string]bool, len(objects))
+	var entries []string
+	for _, obj := range objects {
+		entry := inventoryEntry(obj)
+		current[entry] = true
+		entries = append(entries, entry)
+	}
+
+	var errs []error
+	for _, entry := range strings.Split(cm.Data[inventoryKey], "\n") {
+		if entry == "" || current[entry] {
+			continue
+		}
+		obj, err := parseInventoryEntry(entry)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := c.Delete(ctx, obj); err != nil && !apierrors.IsNotFound(err) {
+			errs = append(errs, fmt.Errorf("failed to prune %s: %w", objectID(obj), err))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+
+	cm.Name, cm.Namespace = key.Name, key.Namespace
+	cm.Data = map[string]string{inventoryKey: strings.Join(entries, "\n")}
+	if exists {
+		err = c.Update(ctx, cm)
+	} else {
+		err = c.Create(ctx, cm)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write inventory %s: %w", key, err)
+	}
+	return nil
+}
+
+// inventoryEntry returns the inventory entry of the given object, in the
+// format apiVersion|kind|namespace|name.
+func inventoryEntry(obj *unstructured.Unstructured) string {
+	return strings.Join([]string{obj.GetAPIVersion(), obj.GetKind(), obj.GetNamespace(), obj.GetName()}, "|")
+}
+
+// parseInventoryEntry returns the object of the given inventory entry.
+func parseInventoryEntry(entry string) (*unstructured.Unstructured, error) {
+	parts := strings.Split(entry, "|")
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("invalid inventory entry %q", entry)
+	}
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion(parts[0])
+	obj.SetKind(parts[1])
+	obj.SetNamespace(parts[2])
+	obj.SetName(parts[3])
+	return obj, nil
+}
+
+// decodeManifests decodes the objects of the given multi-document YAML or
+// JSON. Empty documents are skipped.
+func decodeManifests(b []byte) ([]*unstructured.Unstructured, error) {
+	var objects []*unstructured.Unstructured
+	decoder := kyaml.NewYAMLOrJSONDecoder(bytes.NewReader(b), 4096)
+	for {
+		obj := &unstructured.Unstructured{}
+		if err := decoder.Decode(&obj.Object); err != nil {
+			if errors.Is(err, io.EOF) {
+				return objects, nil
+			}
+			return nil, err
+		}
+		if len(obj.Object) == 0 {
+			continue
+		}
+		if obj.GetKind() == "" || obj.GetAPIVersion() == "" {
+			return nil, fmt.Errorf("object %q has no kind or apiVersion", obj.GetName())
+		}
+		objects = append(objects, obj)
+	}
+}
+
+// crdKind is the kind of CustomResourceDefinitions.
+const crdKind = "CustomResourceDefinition"
+
+// sortManifests sorts the given objects so that CustomResourceDefinitions and
+// Namespaces come first, keeping the order of the other objects.
+func sortManifests(objects []*unstructured.Unstructured) {
+	rank := func(obj *unstructured.Unstructured) int {
+		switch obj.GetKind() {
+		case crdKind:
+			return 0
+		case "Namespace":
+			return 1
+		default:
+			return 2
+		}
+	}
+	sort.SliceStable(objects, func(i, j int) bool {
+		return rank(objects[i]) < rank(objects[j])
+	})
+}
+
+// objectID returns the Kind/namespace/name of the given object.
+func objectID(obj client.Object) string {
+	kind := obj.GetObjectKind().GroupVersionKind().Kind
+	if obj.GetNamespace() == "" {
+		return fmt.Sprintf("%s/%s", kind, obj.GetName())
+	}
+	return fmt.Sprintf("%s/%s/%s", kind, obj.GetNamespace(), obj.GetName())
+}
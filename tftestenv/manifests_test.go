@@ -0,0 +1,293 @@
+/*
+Copyright 2026 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tftestenv
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/cli-utils/pkg/kstatus/status"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// applyClient emulates server-side apply with create or update, which the
+// fake client doesn't support.
+type applyClient struct {
+	client.Client
+}
+
+func (c applyClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	if patch != client.Apply {
+		return c.Client.Patch(ctx, obj, patch, opts...)
+	}
+	existing := &unstructured.Unstructured{}
+	existing.SetGroupVersionKind(obj.GetObjectKind().GroupVersionKind())
+	err := c.Client.Get(ctx, client.ObjectKeyFromObject(obj), existing)
+	if apierrors.IsNotFound(err) {
+		return c.Client.Create(ctx, obj)
+	}
+	if err != nil {
+		return err
+	}
+	obj.SetResourceVersion(existing.GetResourceVersion())
+	return c.Client.Update(ctx, obj)
+}
+
+const testManifests = `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: foo
+  namespace: test
+data:
+  key: value
+---
+---
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: test
+`
+
+func TestManifestsFromFS(t *testing.T) {
+	g := NewWithT(t)
+
+	fsys := fstest.MapFS{
+		"a/manifests.yaml": {Data: []byte(testManifests)},
+		"b/secret.yml":     {Data: []byte("apiVersion: v1\nkind: Secret\nmetadata:\n  name: bar\n  namespace: test\n")},
+		"README.md":        {Data: []byte("# not a manifest")},
+	}
+	objects, err := ManifestsFromFS(fsys)()
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(objects).To(HaveLen(3))
+
+	sortManifests(objects)
+	var ids []string
+	for _, obj := range objects {
+		ids = append(ids, objectID(obj))
+	}
+	g.Expect(ids).To(Equal([]string{"Namespace/test", "ConfigMap/test/foo", "Secret/test/bar"}))
+
+	_, err = ManifestsFromFS(fstest.MapFS{"bad.yaml": {Data: []byte("metadata:\n  name: foo\n")}})()
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestManifestsFromKustomization(t *testing.T) {
+	g := NewWithT(t)
+
+	dir := t.TempDir()
+	g.Expect(os.WriteFile(filepath.Join(dir, "manifests.yaml"), []byte(testManifests), 0o644)).To(Succeed())
+	g.Expect(os.WriteFile(filepath.Join(dir, "kustomization.yaml"),
+		[]byte("resources:\n- manifests.yaml\ncommonLabels:\n  app: test\n"), 0o644)).To(Succeed())
+
+	objects, err := ManifestsFromKustomization(dir)()
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(objects).To(HaveLen(2))
+	for _, obj := range objects {
+		g.Expect(obj.GetLabels()).To(HaveKeyWithValue("app", "test"))
+	}
+}
+
+func TestApplyManifests(t *testing.T) {
+	g := NewWithT(t)
+
+	c := applyClient{fake.NewClientBuilder().Build()}
+	objects, err := decodeManifests([]byte(testManifests))
+	g.Expect(err).ToNot(HaveOccurred())
+
+	opts := ApplyOptions{Inventory: "test-inventory", Timeout: time.Second}
+	report, err := applyManifests(context.Background(), c, objects, opts)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(report).To(HaveLen(2))
+	for _, s := range report {
+		g.Expect(s.Status).To(Equal(status.CurrentStatus))
+	}
+
+	// Re-apply without the ConfigMap prunes it.
+	objects, err = decodeManifests([]byte("apiVersion: v1\nkind: Namespace\nmetadata:\n  name: test\n"))
+	g.Expect(err).ToNot(HaveOccurred())
+	_, err = applyManifests(context.Background(), c, objects, opts)
+	g.Expect(err).ToNot(HaveOccurred())
+	err = c.Get(context.Background(), client.ObjectKey{Namespace: "test", Name: "foo"}, &corev1.ConfigMap{})
+	g.Expect(apierrors.IsNotFound(err)).To(BeTrue())
+}
+
+func TestApplyManifests_timeout(t *testing.T) {
+	g := NewWithT(t)
+
+	c := applyClient{fake.NewClientBuilder().Build()}
+	objects, err := decodeManifests([]byte(`
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  namespace: default
+  generation: 1
+spec:
+  replicas: 1
+`))
+	g.Expect(err).ToNot(HaveOccurred())
+
+	report, err := applyManifests(context.Background(), c, objects, ApplyOptions{Timeout: 100 * time.Millisecond})
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(err.Error()).To(ContainSubstring("Deployment/default/app"))
+	g.Expect(report).To(HaveLen(1))
+	g.Expect(report[0].Status).To(Equal(status.InProgressStatus))
+}
+
+// deadlineClient records the deadlines of the contexts of the apply and get
+// requests.
+type deadlineClient struct {
+	applyClient
+	deadlines *[]time.Time
+}
+
+func (c deadlineClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	c.record(ctx)
+	return c.applyClient.Patch(ctx, obj, patch, opts...)
+}
+
+func (c deadlineClient) Get(ctx context.Context, key client.ObjectKey, obj client.Object) error {
+	c.record(ctx)
+	return c.applyClient.Get(ctx, key, obj)
+}
+
+func (c deadlineClient) record(ctx context.Context) {
+	deadline, _ := ctx.Deadline()
+	*c.deadlines = append(*c.deadlines, deadline)
+}
+
+func TestApplyManifests_sharedTimeout(t *testing.T) {
+	g := NewWithT(t)
+
+	var deadlines []time.Time
+	c := deadlineClient{applyClient{fake.NewClientBuilder().Build()}, &deadlines}
+	objects, err := decodeManifests([]byte(`
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: app
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: app
+  namespace: app
+`))
+	g.Expect(err).ToNot(HaveOccurred())
+
+	_, err = applyManifests(context.Background(), c, objects, ApplyOptions{Timeout: time.Minute})
+	g.Expect(err).ToNot(HaveOccurred())
+
+	// Applying the definitions, the other objects and waiting for them all
+	// share the same deadline.
+	g.Expect(deadlines).ToNot(BeEmpty())
+	g.Expect(deadlines[0]).To(BeTemporally("~", time.Now().Add(time.Minute), 5*time.Second))
+	for _, d := range deadlines {
+		g.Expect(d).To(Equal(deadlines[0]))
+	}
+}
+
+const crdManifests = `
+apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: foo
+  namespace: default
+---
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.example.com
+spec:
+  group: example.com
+  names:
+    kind: Widget
+    plural: widgets
+  scope: Namespaced
+`
+
+// resetMapper records whether it was reset.
+type resetMapper struct {
+	meta.RESTMapper
+	reset bool
+}
+
+func (m *resetMapper) Reset() {
+	m.reset = true
+}
+
+// crdClient emulates an API server which establishes the applied
+// CustomResourceDefinitions and only knows their kinds once its RESTMapper is
+// reset.
+type crdClient struct {
+	applyClient
+	mapper *resetMapper
+}
+
+func (c crdClient) RESTMapper() meta.RESTMapper {
+	return c.mapper
+}
+
+func (c crdClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	gvk := obj.GetObjectKind().GroupVersionKind()
+	if gvk.Kind == "Widget" && !c.mapper.reset {
+		return &meta.NoKindMatchError{GroupKind: gvk.GroupKind(), SearchedVersions: []string{gvk.Version}}
+	}
+	if err := c.applyClient.Patch(ctx, obj, patch, opts...); err != nil {
+		return err
+	}
+	if gvk.Kind != crdKind {
+		return nil
+	}
+	u := obj.(*unstructured.Unstructured)
+	if err := unstructured.SetNestedSlice(u.Object, []interface{}{
+		map[string]interface{}{"type": "Established", "status": "True"},
+	}, "status", "conditions"); err != nil {
+		return err
+	}
+	return c.Client.Update(ctx, u)
+}
+
+func TestApplyManifests_customResources(t *testing.T) {
+	g := NewWithT(t)
+
+	fc := fake.NewClientBuilder().Build()
+	c := crdClient{applyClient{fc}, &resetMapper{RESTMapper: fc.RESTMapper()}}
+	objects, err := decodeManifests([]byte(crdManifests))
+	g.Expect(err).ToNot(HaveOccurred())
+
+	report, err := applyManifests(context.Background(), c, objects, ApplyOptions{Timeout: time.Second})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(report).To(HaveLen(2))
+	g.Expect(c.mapper.reset).To(BeTrue())
+
+	widget := &unstructured.Unstructured{}
+	widget.SetAPIVersion("example.com/v1")
+	widget.SetKind("Widget")
+	g.Expect(c.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "foo"}, widget)).To(Succeed())
+}
@@ -0,0 +1,131 @@
+/*
+Copyright 2026 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tftestenv
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	tfjson "github.com/hashicorp/terraform-json"
+)
+
+// outputTag is the struct field tag used by DecodeOutputs.
+const outputTag = "tfoutput"
+
+// DecodeOutputs decodes the terraform state outputs into the struct pointed to
+// by v. Fields are mapped to outputs with the tfoutput field tag, fields
+// without the tag are ignored. An output value is decoded into the field type
+// like encoding/json would decode it, so an object output can be decoded into
+// a struct or a map. The tag options are:
+//
+//   - optional: the output may be missing or null.
+//   - sensitive: the output may be sensitive. Decoding a sensitive output into
+//     a field without this option is an error, to avoid leaking it by accident.
+//
+// For example:
+//
+//	type outputs struct {
+//		Endpoint string            `tfoutput:"cluster_endpoint"`
+//		CAData   string            `tfoutput:"cluster_ca_data,sensitive"`
+//		Tags     map[string]string `tfoutput:"tags,optional"`
+//	}
+//
+// All the missing outputs, type mismatches and sensitive values are reported
+// together.
+func DecodeOutputs(state map[string]*tfjson.StateOutput, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("expected a non-nil pointer to a struct, got %T", v)
+	}
+	rv = rv.Elem()
+	rt := rv.Type()
+
+	var errs []error
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		tag, ok := field.Tag.Lookup(outputTag)
+		if !ok || tag == "-" || !field.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		var optional, sensitive bool
+		for _, opt := range strings.Split(opts, ",") {
+			switch opt {
+			case "optional":
+				optional = true
+			case "sensitive":
+				sensitive = true
+			}
+		}
+
+		o, ok := state[name]
+		if !ok || o == nil || o.Value == nil {
+			if !optional {
+				errs = append(errs, fmt.Errorf("output %q not found", name))
+			}
+			continue
+		}
+		if o.Sensitive && !sensitive {
+			errs = append(errs, fmt.Errorf("output %q is sensitive, add the sensitive option to the tag of field %s to decode it", name, field.Name))
+			continue
+		}
+
+		b, err := json.Marshal(o.Value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("output %q: %w", name, err))
+			continue
+		}
+		if err := json.Unmarshal(b, rv.Field(i).Addr().Interface()); err != nil {
+			// Don't include the value in the error, it may be sensitive.
+			errs = append(errs, fmt.Errorf("output %q of type %s can't be decoded into field %s of type %s",
+				name, outputType(o.Value), field.Name, field.Type))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// DecodeStateOutput queries the current state output of terraform and decodes
+// it into the struct pointed to by v. See DecodeOutputs for details.
+func (env *Environment) DecodeStateOutput(ctx context.Context, v any) error {
+	state, err := env.StateOutput(ctx)
+	if err != nil {
+		return err
+	}
+	return DecodeOutputs(state, v)
+}
+
+// outputType returns the terraform type name of the given output value.
+func outputType(v any) string {
+	switch v.(type) {
+	case string:
+		return "string"
+	case bool:
+		return "bool"
+	case float64, json.Number:
+		return "number"
+	case []interface{}:
+		return "list"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2026 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tftestenv
+
+import (
+	"testing"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	. "github.com/onsi/gomega"
+)
+
+type testOutputs struct {
+	Endpoint  string            `tfoutput:"cluster_endpoint"`
+	CAData    string            `tfoutput:"cluster_ca_data,sensitive"`
+	NodeCount int               `tfoutput:"node_count"`
+	Tags      map[string]string `tfoutput:"tags,optional"`
+	Ignored   string
+}
+
+func TestDecodeOutputs(t *testing.T) {
+	tests := []struct {
+		name     string
+		state    map[string]*tfjson.StateOutput
+		want     testOutputs
+		wantErrs []string
+	}{
+		{
+			name: "all outputs",
+			state: map[string]*tfjson.StateOutput{
+				"cluster_endpoint": {Value: "https://example.com"},
+				"cluster_ca_data":  {Value: "Y2EK", Sensitive: true},
+				"node_count":       {Value: float64(3)},
+				"tags":             {Value: map[string]interface{}{"ci": "true"}},
+			},
+			want: testOutputs{
+				Endpoint:  "https://example.com",
+				CAData:    "Y2EK",
+				NodeCount: 3,
+				Tags:      map[string]string{"ci": "true"},
+			},
+		},
+		{
+			name: "missing optional output",
+			state: map[string]*tfjson.StateOutput{
+				"cluster_endpoint": {Value: "https://example.com"},
+				"cluster_ca_data":  {Value: "Y2EK"},
+				"node_count":       {Value: float64(1)},
+			},
+			want: testOutputs{
+				Endpoint:  "https://example.com",
+				CAData:    "Y2EK",
+				NodeCount: 1,
+			},
+		},
+		{
+			name: "all errors reported",
+			state: map[string]*tfjson.StateOutput{
+				"cluster_endpoint": {Value: "https://example.com", Sensitive: true},
+				"node_count":       {Value: "three"},
+			},
+			wantErrs: []string{
+				`output "cluster_endpoint" is sensitive`,
+				`output "cluster_ca_data" not found`,
+				`output "node_count" of type string can't be decoded into field NodeCount of type int`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			var got testOutputs
+			err := DecodeOutputs(tt.state, &got)
+			if len(tt.wantErrs) > 0 {
+				g.Expect(err).To(HaveOccurred())
+				for _, e := range tt.wantErrs {
+					g.Expect(err.Error()).To(ContainSubstring(e))
+				}
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(got).To(Equal(tt.want))
+		})
+	}
+}
+
+func TestDecodeOutputsInvalidTarget(t *testing.T) {
+	g := NewWithT(t)
+
+	var s testOutputs
+	g.Expect(DecodeOutputs(nil, s)).ToNot(Succeed())
+	g.Expect(DecodeOutputs(nil, (*testOutputs)(nil))).ToNot(Succeed())
+}
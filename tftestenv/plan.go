@@ -0,0 +1,168 @@
+/*
+Copyright 2026 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tftestenv
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/terraform-exec/tfexec"
+	tfjson "github.com/hashicorp/terraform-json"
+)
+
+const (
+	// planFile is the name of the saved plan file in the build directory.
+	planFile = "tfplan"
+	// planJSONFile is the name of the JSON representation of the saved plan
+	// in the build directory.
+	planJSONFile = "tfplan.json"
+)
+
+// ErrPlanRejected is returned when a plan is rejected by a PlanPolicy.
+var ErrPlanRejected = errors.New("plan rejected")
+
+// PlanPolicy checks a plan before it's applied and returns an error to reject
+// it.
+type PlanPolicy func(plan *tfjson.Plan) error
+
+// WithPlan configures the Environment to run terraform plan before apply. The
+// plan is saved in the build directory as tfplan along with its JSON
+// representation tfplan.json, and is applied as is.
+func WithPlan(plan bool) EnvironmentOption {
+	return func(e *Environment) {
+		e.planEnabled = plan
+	}
+}
+
+// WithPlanPolicies configures policies that check the plan before it's
+// applied. It enables the plan phase. When a policy rejects the plan, nothing
+// is applied and nothing is destroyed.
+func WithPlanPolicies(policies ...PlanPolicy) EnvironmentOption {
+	return func(e *Environment) {
+		e.planEnabled = true
+		e.planPolicies = append(e.planPolicies, policies...)
+	}
+}
+
+// DenyReplace is a PlanPolicy that rejects plans that delete or replace
+// existing resources. It's useful along with WithExisting to ensure that the
+// existing infrastructure is only updated in-place.
+func DenyReplace(plan *tfjson.Plan) error {
+	var addrs []string
+	for _, rc := range plan.ResourceChanges {
+		if rc.Change == nil {
+			continue
+		}
+		if rc.Change.Actions.Delete() || rc.Change.Actions.Replace() {
+			addrs = append(addrs, rc.Address)
+		}
+	}
+	if len(addrs) > 0 {
+		return fmt.Errorf("plan deletes or replaces resources: %s", strings.Join(addrs, ", "))
+	}
+	return nil
+}
+
+// MaxResourceChanges returns a PlanPolicy that rejects plans that change more
+// than the given number of resources.
+func MaxResourceChanges(max int) PlanPolicy {
+	return func(plan *tfjson.Plan) error {
+		var changes int
+		for _, rc := range plan.ResourceChanges {
+			if rc.Change == nil || rc.Change.Actions.NoOp() || rc.Change.Actions.Read() {
+				continue
+			}
+			changes++
+		}
+		if changes > max {
+			return fmt.Errorf("plan changes %d resources, more than the budget of %d", changes, max)
+		}
+		return nil
+	}
+}
+
+// runPlan runs terraform plan, saves the plan in the build directory and
+// checks it against the plan policies. It returns the path of the saved plan.
+func (env *Environment) runPlan(ctx context.Context) (string, error) {
+	env.phaseLogger("plan").Info("Planning Terraform")
+	planPath := filepath.Join(env.buildDir, planFile)
+	opts := append(planOptions(env.tfApplyOptions), tfexec.Out(planPath))
+	stopOutput := env.phaseOutput("plan")
+	_, err := env.tf.Plan(ctx, opts...)
+	stopOutput()
+	if err != nil {
+		return "", fmt.Errorf("error running plan: %w", classifyError(err))
+	}
+
+	plan, err := env.tf.ShowPlanFile(ctx, planPath)
+	if err != nil {
+		return "", fmt.Errorf("could not read plan: %w", err)
+	}
+	env.Plan = plan
+
+	b, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode plan: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(env.buildDir, planJSONFile), b, 0o644); err != nil {
+		return "", fmt.Errorf("failed to write plan: %w", err)
+	}
+
+	var errs []error
+	for _, policy := range env.planPolicies {
+		if err := policy(plan); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return "", fmt.Errorf("%w: %w", ErrPlanRejected, err)
+	}
+	return planPath, nil
+}
+
+// planOptions returns the terraform plan options equivalent to the given
+// apply options.
+func planOptions(opts []tfexec.ApplyOption) []tfexec.PlanOption {
+	var result []tfexec.PlanOption
+	for _, o := range opts {
+		if po, ok := o.(tfexec.PlanOption); ok {
+			result = append(result, po)
+		}
+	}
+	return result
+}
+
+// savedPlanApplyOptions returns the apply options that can be used when
+// applying a saved plan. Options that affect the plan, like variables and
+// targets, are already part of the saved plan and can't be set again.
+func savedPlanApplyOptions(opts []tfexec.ApplyOption) []tfexec.ApplyOption {
+	var result []tfexec.ApplyOption
+	for _, o := range opts {
+		switch o.(type) {
+		case *tfexec.BackupOption, *tfexec.LockOption, *tfexec.LockTimeoutOption,
+			*tfexec.ParallelismOption, *tfexec.ReattachOption, *tfexec.StateOption,
+			*tfexec.StateOutOption:
+			result = append(result, o)
+		}
+	}
+	return result
+}
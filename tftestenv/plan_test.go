@@ -0,0 +1,116 @@
+/*
+Copyright 2026 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tftestenv
+
+import (
+	"testing"
+
+	"github.com/hashicorp/terraform-exec/tfexec"
+	tfjson "github.com/hashicorp/terraform-json"
+	. "github.com/onsi/gomega"
+)
+
+// newTestPlan returns a plan with a resource change of the given actions for
+// every address.
+func newTestPlan(changes map[string]tfjson.Actions) *tfjson.Plan {
+	plan := &tfjson.Plan{}
+	for addr, actions := range changes {
+		plan.ResourceChanges = append(plan.ResourceChanges, &tfjson.ResourceChange{
+			Address: addr,
+			Change:  &tfjson.Change{Actions: actions},
+		})
+	}
+	return plan
+}
+
+func TestPlanPolicies(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  PlanPolicy
+		changes map[string]tfjson.Actions
+		wantErr string
+	}{
+		{
+			name:   "deny replace allows create and update",
+			policy: DenyReplace,
+			changes: map[string]tfjson.Actions{
+				"aws_eks_cluster.this":    {tfjson.ActionCreate},
+				"aws_ecr_repository.this": {tfjson.ActionUpdate},
+			},
+		},
+		{
+			name:   "deny replace rejects replace",
+			policy: DenyReplace,
+			changes: map[string]tfjson.Actions{
+				"aws_eks_cluster.this": {tfjson.ActionDelete, tfjson.ActionCreate},
+			},
+			wantErr: "aws_eks_cluster.this",
+		},
+		{
+			name:   "deny replace rejects delete",
+			policy: DenyReplace,
+			changes: map[string]tfjson.Actions{
+				"aws_ecr_repository.this": {tfjson.ActionDelete},
+			},
+			wantErr: "aws_ecr_repository.this",
+		},
+		{
+			name:   "budget ignores no-op and read",
+			policy: MaxResourceChanges(1),
+			changes: map[string]tfjson.Actions{
+				"aws_eks_cluster.this": {tfjson.ActionCreate},
+				"data.aws_region.this": {tfjson.ActionRead},
+				"aws_iam_role.this":    {tfjson.ActionNoop},
+			},
+		},
+		{
+			name:   "budget exceeded",
+			policy: MaxResourceChanges(1),
+			changes: map[string]tfjson.Actions{
+				"aws_eks_cluster.this":    {tfjson.ActionCreate},
+				"aws_ecr_repository.this": {tfjson.ActionCreate},
+			},
+			wantErr: "plan changes 2 resources",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			err := tt.policy(newTestPlan(tt.changes))
+			if tt.wantErr != "" {
+				g.Expect(err).To(MatchError(ContainSubstring(tt.wantErr)))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+		})
+	}
+}
+
+func TestPlanOptions(t *testing.T) {
+	g := NewWithT(t)
+
+	opts := []tfexec.ApplyOption{
+		tfexec.Var("foo=bar"),
+		tfexec.VarFile("vars.tfvars"),
+		tfexec.Parallelism(4),
+		tfexec.Lock(false),
+	}
+	g.Expect(planOptions(opts)).To(HaveLen(4))
+	g.Expect(savedPlanApplyOptions(opts)).To(ConsistOf(tfexec.Parallelism(4), tfexec.Lock(false)))
+}
@@ -0,0 +1,134 @@
+/*
+Copyright 2026 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tftestenv
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	tfjson "github.com/hashicorp/terraform-json"
+)
+
+// Provider is a cloud provider of the terraform test environment. It uses the
+// terraform state outputs of the infrastructure to interact with the created
+// cluster and registry.
+type Provider interface {
+	// Name returns the name of the provider, as set in Options.Provider.
+	Name() string
+	// RequiredOutputs returns the names of the terraform outputs the provider
+	// needs for the given operation.
+	RequiredOutputs(op Operation) []string
+	// CreateKubeconfig creates a kubeconfig for the target cluster at the
+	// given path.
+	CreateKubeconfig(ctx context.Context, state map[string]*tfjson.StateOutput, kcPath string) error
+	// RegistryLogin logs the docker client into the registry and returns the
+	// registry URL.
+	RegistryLogin(ctx context.Context, state map[string]*tfjson.StateOutput) (string, error)
+	// RegistryAuthenticator returns an in-process authenticator for the
+	// registry, which needs no CLI and doesn't change the docker config.
+	RegistryAuthenticator(ctx context.Context, state map[string]*tfjson.StateOutput) (authn.Authenticator, error)
+	// PushTestAppImages pushes the given local images, keyed by name, to the
+	// registry with the RegistryAuthenticator and returns the pushed images,
+	// keyed by the same names.
+	PushTestAppImages(ctx context.Context, state map[string]*tfjson.StateOutput, localImgs map[string]string) (map[string]PushedImage, error)
+}
+
+// Operation is an operation of a Provider that uses terraform outputs.
+type Operation string
+
+const (
+	// OperationKubeconfig is the creation of the kubeconfig of a cluster.
+	OperationKubeconfig Operation = "kubeconfig"
+	// OperationRegistry is the registry login and the push of images.
+	OperationRegistry Operation = "registry"
+)
+
+// providers is the registry of the known providers, keyed by name.
+var providers = map[string]Provider{}
+
+func init() {
+	RegisterProvider(AWSProvider{})
+	RegisterProvider(AzureProvider{})
+	RegisterProvider(GCPProvider{})
+	RegisterProvider(LocalProvider{})
+}
+
+// RegisterProvider adds the given provider to the provider registry, replacing
+// any existing provider with the same name. The provider name becomes a valid
+// value for Options.Provider. It is not safe for concurrent use and is
+// expected to be called from an init function.
+func RegisterProvider(p Provider) {
+	if !slices.Contains(supportedProviders, p.Name()) {
+		supportedProviders = append(supportedProviders, p.Name())
+		slices.Sort(supportedProviders)
+	}
+	providers[p.Name()] = p
+}
+
+// GetProvider returns the registered provider with the given name.
+func GetProvider(name string) (Provider, error) {
+	p, ok := providers[name]
+	if !ok {
+		return nil, fmt.Errorf("unsupported provider %q, must be one of %v", name, supportedProviders)
+	}
+	return p, nil
+}
+
+// ValidateOutputs checks that the terraform state contains all the outputs
+// required by the given provider for the given operation.
+func ValidateOutputs(p Provider, op Operation, state map[string]*tfjson.StateOutput) error {
+	var missing []string
+	for _, name := range p.RequiredOutputs(op) {
+		if o, ok := state[name]; !ok || o == nil || o.Value == nil {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing required %s provider %s outputs: %s", p.Name(), op, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// stateOutputString returns the string value of the named terraform output.
+func stateOutputString(state map[string]*tfjson.StateOutput, name string) (string, error) {
+	o, ok := state[name]
+	if !ok || o == nil || o.Value == nil {
+		return "", fmt.Errorf("output %q not found", name)
+	}
+	v, ok := o.Value.(string)
+	if !ok {
+		return "", fmt.Errorf("output %q is %T, expected string", name, o.Value)
+	}
+	return v, nil
+}
+
+// stateOutputStrings returns the string values of the named terraform
+// outputs, in the same order.
+func stateOutputStrings(state map[string]*tfjson.StateOutput, names ...string) ([]string, error) {
+	values := make([]string, 0, len(names))
+	for _, name := range names {
+		v, err := stateOutputString(state, name)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2026 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tftestenv
+
+import (
+	"testing"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	. "github.com/onsi/gomega"
+)
+
+func TestGetProvider(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(supportedProviders).To(Equal([]string{"aws", "azure", "gcp", "local"}))
+	for _, name := range supportedProviders {
+		p, err := GetProvider(name)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(p.Name()).To(Equal(name))
+	}
+
+	_, err := GetProvider("foo")
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestValidateOutputs(t *testing.T) {
+	tests := []struct {
+		name    string
+		op      Operation
+		state   map[string]*tfjson.StateOutput
+		wantErr string
+	}{
+		{
+			name: "all outputs",
+			op:   OperationKubeconfig,
+			state: map[string]*tfjson.StateOutput{
+				"aks_kubeconfig":   {Value: "foo"},
+				"acr_registry_url": {Value: "bar"},
+			},
+		},
+		{
+			name: "cluster only",
+			op:   OperationKubeconfig,
+			state: map[string]*tfjson.StateOutput{
+				"aks_kubeconfig": {Value: "foo"},
+			},
+		},
+		{
+			name: "missing registry output",
+			op:   OperationRegistry,
+			state: map[string]*tfjson.StateOutput{
+				"aks_kubeconfig": {Value: "foo"},
+			},
+			wantErr: "acr_registry_url",
+		},
+		{
+			name: "nil value",
+			op:   OperationKubeconfig,
+			state: map[string]*tfjson.StateOutput{
+				"aks_kubeconfig":   {Value: nil},
+				"acr_registry_url": {Value: "bar"},
+			},
+			wantErr: "aks_kubeconfig",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			err := ValidateOutputs(AzureProvider{}, tt.op, tt.state)
+			if tt.wantErr != "" {
+				g.Expect(err).To(MatchError(ContainSubstring(tt.wantErr)))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+		})
+	}
+}
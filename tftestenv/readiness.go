@@ -0,0 +1,262 @@
+/*
+Copyright 2026 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tftestenv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// defaultReadinessTimeout is the time budget of the readiness gate when
+	// none is configured.
+	defaultReadinessTimeout = 10 * time.Minute
+	// readinessPollInterval is the interval at which the readiness checks are
+	// run.
+	readinessPollInterval = 5 * time.Second
+)
+
+// ReadinessCheck checks a part of the environment and returns an error
+// describing what's still pending if it isn't ready.
+type ReadinessCheck func(ctx context.Context, env *Environment) error
+
+// ReadinessGate configures the checks that the cluster of the environment must
+// pass before New returns.
+type ReadinessGate struct {
+	// MinReadyNodes is the number of nodes that must be Ready. Defaults to 1.
+	MinReadyNodes int
+	// Timeout is the time budget for the cluster to get ready. Defaults to 10
+	// minutes.
+	Timeout time.Duration
+	// SkipDefaultChecks disables the default checks, leaving only Checks.
+	SkipDefaultChecks bool
+	// Checks are extra checks run along with the default checks, for example
+	// to wait for webhooks to be reachable.
+	Checks []ReadinessCheck
+}
+
+// WithReadinessGate configures New to wait for the clusters of the environment
+// to be ready before running the after ready hooks and returning. By default,
+// it checks for every cluster that the API server is reachable, that at least
+// MinReadyNodes nodes are Ready, that the kube-system Deployments are
+// available and that the default ServiceAccount exists. The checks are retried until they all
+// pass, and on timeout the error reports what was still pending.
+func WithReadinessGate(gate ReadinessGate) EnvironmentOption {
+	return func(e *Environment) {
+		e.readinessGate = &gate
+	}
+}
+
+// waitReady runs the readiness gate of the environment, if configured. The
+// default checks run against every cluster of the environment, and are
+// skipped in envtest mode, which has no nodes and no controllers.
+func (env *Environment) waitReady(ctx context.Context) error {
+	gate := env.readinessGate
+	if gate == nil {
+		return nil
+	}
+
+	var checks []func(context.Context) error
+	if !gate.SkipDefaultChecks && env.envtest == nil {
+		clients := map[string]kubernetes.Interface{}
+		for name, c := range env.Clusters {
+			clients[name] = c.ClientGo
+		}
+		if len(clients) == 0 {
+			clients[""] = env.ClientGo
+		}
+		checks = append(checks, clusterReadinessChecks(clients, gate.MinReadyNodes)...)
+	}
+	for _, check := range gate.Checks {
+		checks = append(checks, func(ctx context.Context) error {
+			return check(ctx, env)
+		})
+	}
+
+	timeout := gate.Timeout
+	if timeout == 0 {
+		timeout = defaultReadinessTimeout
+	}
+	ctx = logr.NewContext(ctx, env.phaseLogger("readiness"))
+	start := time.Now()
+	if err := waitReady(ctx, timeout, checks); err != nil {
+		return err
+	}
+	env.logPhaseDone("readiness", start)
+	return nil
+}
+
+// waitReady runs the given checks until they all pass or the timeout expires,
+// in which case the errors of the last run are returned.
+func waitReady(ctx context.Context, timeout time.Duration, checks []func(context.Context) error) error {
+	loggerFrom(ctx).Info("Waiting for the cluster to be ready...")
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var pending error
+	err := wait.PollImmediateUntilWithContext(ctx, readinessPollInterval, func(ctx context.Context) (bool, error) {
+		var errs []error
+		for _, check := range checks {
+			errs = append(errs, check(ctx))
+		}
+		pending = errors.Join(errs...)
+		return pending == nil, nil
+	})
+	if err != nil {
+		if pending != nil {
+			return fmt.Errorf("cluster not ready after %s: %w", timeout, pending)
+		}
+		return fmt.Errorf("cluster not ready after %s: %w", timeout, err)
+	}
+	return nil
+}
+
+// clusterReadinessChecks returns the default checks of the readiness gate for
+// every given cluster, keyed by name. The errors of the checks of a named
+// cluster are prefixed with its name.
+func clusterReadinessChecks(clients map[string]kubernetes.Interface, minReadyNodes int) []func(context.Context) error {
+	names := make([]string, 0, len(clients))
+	for name := range clients {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var checks []func(context.Context) error
+	for _, name := range names {
+		for _, check := range defaultReadinessChecks(clients[name], minReadyNodes) {
+			if name == "" {
+				checks = append(checks, check)
+				continue
+			}
+			checks = append(checks, func(ctx context.Context) error {
+				if err := check(ctx); err != nil {
+					return fmt.Errorf("cluster %s: %w", name, err)
+				}
+				return nil
+			})
+		}
+	}
+	return checks
+}
+
+// defaultReadinessChecks returns the default checks of the readiness gate.
+func defaultReadinessChecks(c kubernetes.Interface, minReadyNodes int) []func(context.Context) error {
+	if minReadyNodes == 0 {
+		minReadyNodes = 1
+	}
+	return []func(context.Context) error{
+		func(ctx context.Context) error {
+			return checkAPIServer(ctx, c)
+		},
+		func(ctx context.Context) error {
+			return checkNodesReady(ctx, c, minReadyNodes)
+		},
+		func(ctx context.Context) error {
+			return checkDeploymentsAvailable(ctx, c, metav1.NamespaceSystem)
+		},
+		func(ctx context.Context) error {
+			return checkDefaultServiceAccount(ctx, c)
+		},
+	}
+}
+
+// checkAPIServer checks that the API server is reachable.
+func checkAPIServer(ctx context.Context, c kubernetes.Interface) error {
+	var err error
+	if rc := c.Discovery().RESTClient(); rc != nil {
+		err = rc.Get().AbsPath("/version").Do(ctx).Error()
+	} else {
+		// The fake clientset has no REST client.
+		_, err = c.Discovery().ServerVersion()
+	}
+	if err != nil {
+		return fmt.Errorf("API server not reachable: %w", err)
+	}
+	return nil
+}
+
+// checkNodesReady checks that at least min nodes are Ready.
+func checkNodesReady(ctx context.Context, c kubernetes.Interface, min int) error {
+	nodes, err := c.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list nodes: %w", err)
+	}
+	var ready int
+	for _, node := range nodes.Items {
+		for _, cond := range node.Status.Conditions {
+			if cond.Type == corev1.NodeReady && cond.Status == corev1.ConditionTrue {
+				ready++
+				break
+			}
+		}
+	}
+	if ready < min {
+		return fmt.Errorf("%d/%d nodes Ready, want at least %d", ready, len(nodes.Items), min)
+	}
+	return nil
+}
+
+// checkDeploymentsAvailable checks that all the Deployments of the given
+// namespace are available with all their replicas updated.
+func checkDeploymentsAvailable(ctx context.Context, c kubernetes.Interface, namespace string) error {
+	deployments, err := c.AppsV1().Deployments(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list Deployments in %s: %w", namespace, err)
+	}
+	var pending []string
+	for _, d := range deployments.Items {
+		if !deploymentAvailable(&d) {
+			pending = append(pending, d.Name)
+		}
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("deployments not available in %s: %s", namespace, strings.Join(pending, ", "))
+	}
+	return nil
+}
+
+// deploymentAvailable returns true if the latest generation of the given
+// Deployment is observed and all its replicas are updated and available.
+func deploymentAvailable(d *appsv1.Deployment) bool {
+	replicas := int32(1)
+	if d.Spec.Replicas != nil {
+		replicas = *d.Spec.Replicas
+	}
+	return d.Status.ObservedGeneration >= d.Generation &&
+		d.Status.UpdatedReplicas >= replicas &&
+		d.Status.AvailableReplicas >= replicas
+}
+
+// checkDefaultServiceAccount checks that the default ServiceAccount of the
+// default namespace exists, which is needed to create pods.
+func checkDefaultServiceAccount(ctx context.Context, c kubernetes.Interface) error {
+	if _, err := c.CoreV1().ServiceAccounts(metav1.NamespaceDefault).Get(ctx, "default", metav1.GetOptions{}); err != nil {
+		return fmt.Errorf("default ServiceAccount not found: %w", err)
+	}
+	return nil
+}
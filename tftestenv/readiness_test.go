@@ -0,0 +1,137 @@
+/*
+Copyright 2026 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tftestenv
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+	"k8s.io/utils/pointer"
+)
+
+func readyNode(name string, ready bool) *corev1.Node {
+	status := corev1.ConditionFalse
+	if ready {
+		status = corev1.ConditionTrue
+	}
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status: corev1.NodeStatus{
+			Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: status}},
+		},
+	}
+}
+
+func TestDefaultReadinessChecks(t *testing.T) {
+	g := NewWithT(t)
+
+	coredns := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "coredns", Namespace: metav1.NamespaceSystem, Generation: 1},
+		Spec:       appsv1.DeploymentSpec{Replicas: pointer.Int32(2)},
+		Status:     appsv1.DeploymentStatus{ObservedGeneration: 1, UpdatedReplicas: 2, AvailableReplicas: 1},
+	}
+	c := fake.NewSimpleClientset(readyNode("node-1", true), readyNode("node-2", false), coredns)
+
+	err := waitReady(context.Background(), 100*time.Millisecond, defaultReadinessChecks(c, 2))
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(err.Error()).To(ContainSubstring("1/2 nodes Ready, want at least 2"))
+	g.Expect(err.Error()).To(ContainSubstring("deployments not available in kube-system: coredns"))
+	g.Expect(err.Error()).To(ContainSubstring("default ServiceAccount not found"))
+
+	coredns.Status.AvailableReplicas = 2
+	_, err = c.AppsV1().Deployments(metav1.NamespaceSystem).UpdateStatus(context.Background(), coredns, metav1.UpdateOptions{})
+	g.Expect(err).ToNot(HaveOccurred())
+	_, err = c.CoreV1().Nodes().UpdateStatus(context.Background(), readyNode("node-2", true), metav1.UpdateOptions{})
+	g.Expect(err).ToNot(HaveOccurred())
+	_, err = c.CoreV1().ServiceAccounts(metav1.NamespaceDefault).Create(context.Background(),
+		&corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: metav1.NamespaceDefault}},
+		metav1.CreateOptions{})
+	g.Expect(err).ToNot(HaveOccurred())
+
+	g.Expect(waitReady(context.Background(), time.Second, defaultReadinessChecks(c, 2))).To(Succeed())
+}
+
+func TestWaitReady(t *testing.T) {
+	g := NewWithT(t)
+
+	// Without a gate, nothing is checked.
+	env := &Environment{}
+	g.Expect(env.waitReady(context.Background())).To(Succeed())
+
+	var calls int
+	WithReadinessGate(ReadinessGate{
+		SkipDefaultChecks: true,
+		Timeout:           100 * time.Millisecond,
+		Checks: []ReadinessCheck{
+			func(ctx context.Context, env *Environment) error {
+				calls++
+				return errors.New("webhook not reachable")
+			},
+		},
+	})(env)
+	err := env.waitReady(context.Background())
+	g.Expect(err).To(MatchError(ContainSubstring("webhook not reachable")))
+	g.Expect(calls).To(BeNumerically(">", 0))
+}
+
+func TestClusterReadinessChecks(t *testing.T) {
+	g := NewWithT(t)
+
+	defaultSA := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: metav1.NamespaceDefault}}
+	clients := map[string]kubernetes.Interface{
+		"hub":   fake.NewSimpleClientset(readyNode("node-1", true), defaultSA.DeepCopy()),
+		"spoke": fake.NewSimpleClientset(readyNode("node-1", false), defaultSA.DeepCopy()),
+	}
+
+	err := waitReady(context.Background(), 100*time.Millisecond, clusterReadinessChecks(clients, 1))
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(err.Error()).To(ContainSubstring("cluster spoke: 0/1 nodes Ready"))
+	g.Expect(err.Error()).ToNot(ContainSubstring("cluster hub"))
+}
+
+func TestCheckAPIServer(t *testing.T) {
+	g := NewWithT(t)
+
+	// API server which never answers.
+	done := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer srv.Close()
+	defer close(done)
+
+	c, err := kubernetes.NewForConfig(&rest.Config{Host: srv.URL})
+	g.Expect(err).ToNot(HaveOccurred())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err = checkAPIServer(ctx, c)
+	g.Expect(err).To(MatchError(ContainSubstring("API server not reachable")))
+	g.Expect(time.Since(start)).To(BeNumerically("<", 5*time.Second))
+}
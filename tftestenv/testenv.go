@@ -20,12 +20,15 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
+	"net/http/httptest"
 	"os"
 	"os/signal"
 	"path/filepath"
 	"syscall"
+	"time"
 
+	"github.com/go-logr/logr"
+	"github.com/hashicorp/go-version"
 	install "github.com/hashicorp/hc-install"
 	"github.com/hashicorp/hc-install/fs"
 	"github.com/hashicorp/hc-install/product"
@@ -33,13 +36,14 @@ import (
 	"github.com/hashicorp/hc-install/src"
 	"github.com/hashicorp/terraform-exec/tfexec"
 	tfjson "github.com/hashicorp/terraform-json"
+	"golang.org/x/oauth2"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
-	"k8s.io/klog/v2/klogr"
+	"k8s.io/client-go/transport"
 	"sigs.k8s.io/controller-runtime/pkg/client"
-	runtimeLog "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
 )
 
 var shutdownSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
@@ -53,8 +57,21 @@ type Environment struct {
 	// CreateKubeconfig provides the terraform state output which is used to
 	// construct kubeconfig.
 	CreateKubeconfig CreateKubeconfig
+	// CreateTokenSource, if set, provides a refreshing token source used by
+	// the clients to authenticate with the cluster instead of the credentials
+	// in the kubeconfig.
+	CreateTokenSource CreateTokenSource
+
+	// Plan is the terraform plan that was applied, if configured with
+	// WithPlan.
+	Plan *tfjson.Plan
+
+	// Clusters are the named clusters of the environment, if configured with
+	// WithClusters.
+	Clusters map[string]*Cluster
 
 	tf       *tfexec.Terraform
+	provider Provider
 	retain   bool
 	existing bool
 	verbose  bool
@@ -65,12 +82,85 @@ type Environment struct {
 	// tfDestroyOptions are the terraform destroy options to use when running
 	// terraform destroy.
 	tfDestroyOptions []tfexec.DestroyOption
+	// tfVersion is the version constraint of the terraform binary.
+	tfVersion string
+	// tfInstallDir is the directory where terraform is installed and looked
+	// up.
+	tfInstallDir string
+	// tfReleasesURL is the base URL of the terraform releases.
+	tfReleasesURL string
+	// tofu configures the environment to use OpenTofu instead of terraform.
+	tofu bool
+	// splitClusters splits the state outputs into the outputs of every
+	// cluster.
+	splitClusters SplitClusterOutputs
+	// defaultCluster is the name of the cluster used by the embedded clients.
+	defaultCluster string
+	// workspace is the terraform workspace of the environment.
+	workspace string
+	// autoWorkspace configures the environment to generate a workspace for
+	// every run.
+	autoWorkspace bool
+	// workspaceRecord is the path of the record of the auto-generated
+	// workspace.
+	workspaceRecord string
+	// planEnabled configures the environment to run plan before apply.
+	planEnabled bool
+	// planPolicies are the checks run against the plan before apply.
+	planPolicies []PlanPolicy
+	// vars are the terraform variables of the environment.
+	vars map[string]any
+	// varFiles are the terraform variable files of the environment.
+	varFiles []string
+	// applyRetries is the number of times a retryable apply failure is
+	// retried.
+	applyRetries int
+	// applyBackoff is the delay before the first apply retry, doubled for
+	// every retry.
+	applyBackoff time.Duration
+	// destroyRetries is the number of times a destroy failure is retried.
+	destroyRetries int
+	// destroyBackoff is the delay before the first destroy retry, doubled for
+	// every retry.
+	destroyBackoff time.Duration
+	// timeouts are the time budgets of the environment phases.
+	timeouts Timeouts
+	// hooks are the lifecycle hooks of the environment.
+	hooks []Hooks
+	// scheme is the scheme of the clients created by Destroy.
+	scheme *runtime.Scheme
+	// cleanup enables the deletion of the cloud-backed Kubernetes objects
+	// before destroy.
+	cleanup bool
+	// cleanupTimeout is the time budget of the cloud-backed objects cleanup.
+	cleanupTimeout time.Duration
+	// readinessGate are the checks the cluster must pass before New returns.
+	readinessGate *ReadinessGate
+	// logger is the logger of the environment.
+	logger logr.Logger
+	// diagnosticsOnFailure reports a test failure, in which case Stop collects
+	// a diagnostics bundle with diagnosticsOpts.
+	diagnosticsOnFailure func() bool
+	diagnosticsOpts      DiagnosticsOptions
+
+	// envtest is the local control plane used instead of terraform.
+	envtest *envtest.Environment
+	// registry is the in-process OCI registry used along with envtest.
+	registry *httptest.Server
+	// localOutputs are the emulated terraform outputs of envtest.
+	localOutputs map[string]*tfjson.StateOutput
 }
 
 // createKubeconfig create a kubeconfig for the target cluster and writes to
 // the given path using the contextual values from the infrastructure state.
 type CreateKubeconfig func(ctx context.Context, state map[string]*tfjson.StateOutput, kcPath string) error
 
+// CreateTokenSource creates a token source for authenticating with the target
+// cluster using the contextual values from the infrastructure state. The given
+// context isn't cancelled when New returns, so the token source can keep using
+// it.
+type CreateTokenSource func(ctx context.Context, state map[string]*tfjson.StateOutput) (oauth2.TokenSource, error)
+
 // EnvironmentOption is used to configure the Environment.
 type EnvironmentOption func(*Environment)
 
@@ -91,7 +181,9 @@ func WithExisting(existing bool) EnvironmentOption {
 	}
 }
 
-// WithVerbose configures the terraform executor to run in verbose mode.
+// WithVerbose configures the terraform executor to run in verbose mode. The
+// output of terraform and of the commands is streamed to the console with a
+// line prefix, in addition to the log files in the logs directory.
 func WithVerbose(verbose bool) EnvironmentOption {
 	return func(e *Environment) {
 		e.verbose = verbose
@@ -106,6 +198,27 @@ func WithCreateKubeconfig(create CreateKubeconfig) EnvironmentOption {
 	}
 }
 
+// WithProvider configures the Environment to create the kubeconfig using the
+// given Provider. The terraform outputs are validated against the outputs
+// required by the provider before the kubeconfig is created.
+func WithProvider(p Provider) EnvironmentOption {
+	return func(e *Environment) {
+		e.provider = p
+		e.CreateKubeconfig = p.CreateKubeconfig
+	}
+}
+
+// WithTokenSource configures the clients of the Environment to authenticate
+// using a token source created from the output state of the terraform
+// infrastructure. This is useful for clusters with short-lived tokens, like
+// EKS, where a static token in the kubeconfig expires before a long running
+// test suite completes.
+func WithTokenSource(create CreateTokenSource) EnvironmentOption {
+	return func(e *Environment) {
+		e.CreateTokenSource = create
+	}
+}
+
 // WithBuildDir sets the build directory for the environment. Defaults to
 // "build".
 func WithBuildDir(dir string) EnvironmentOption {
@@ -128,14 +241,53 @@ func WithTfDestroyOptions(opts ...tfexec.DestroyOption) EnvironmentOption {
 	}
 }
 
+// WithApplyRetries configures the number of times terraform apply is retried
+// when it fails with a retryable error, like cloud API throttling or eventual
+// consistency errors. The delay before the first retry is backoff, and it's
+// doubled for every retry. Apply errors are returned as TerraformError.
+func WithApplyRetries(retries int, backoff time.Duration) EnvironmentOption {
+	return func(e *Environment) {
+		e.applyRetries = retries
+		e.applyBackoff = backoff
+	}
+}
+
+// WithTerraformVersion configures the version constraint of the terraform
+// binary, for example "~> 1.5.0". By default, any terraform binary found in
+// PATH is used, else the latest version is downloaded.
+func WithTerraformVersion(constraint string) EnvironmentOption {
+	return func(e *Environment) {
+		e.tfVersion = constraint
+	}
+}
+
+// WithTerraformInstallDir configures the directory where the terraform binary
+// is installed. A binary in this directory is reused if it satisfies the
+// version constraint, which allows sharing it across test runs. Defaults to
+// the build directory.
+func WithTerraformInstallDir(dir string) EnvironmentOption {
+	return func(e *Environment) {
+		e.tfInstallDir = dir
+	}
+}
+
+// WithTerraformReleasesURL configures an alternate base URL of a terraform
+// release mirror to download the terraform binary from. The mirror must have
+// the same layout as https://releases.hashicorp.com. When used with WithTofu,
+// the mirror must serve the OpenTofu versions API at api.json, the release
+// signing key at opentofu.asc and the release artifacts in the layout of the
+// OpenTofu GitHub releases.
+func WithTerraformReleasesURL(url string) EnvironmentOption {
+	return func(e *Environment) {
+		e.tfReleasesURL = url
+	}
+}
+
 // New finds or downloads terraform binary, uses it to run terraform in the
 // given terraformPath to create a kubernetes cluster. A kubeconfig of the
 // created cluster is constructed at the given kubeconfigPath which is then used
 // to construct a kubernetes client that can be used in the tests.
 func New(ctx context.Context, scheme *runtime.Scheme, terraformPath string, kubeconfigPath string, opts ...EnvironmentOption) (*Environment, error) {
-	// Set a default logger if not set already.
-	runtimeLog.SetLogger(klogr.New())
-
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
@@ -147,6 +299,7 @@ func New(ctx context.Context, scheme *runtime.Scheme, terraformPath string, kube
 	for _, opt := range opts {
 		opt(env)
 	}
+	ctx = env.setUpLogger(ctx)
 
 	// Prepare build environment.
 	cwd, err := os.Getwd()
@@ -157,35 +310,30 @@ func New(ctx context.Context, scheme *runtime.Scheme, terraformPath string, kube
 	if err := os.MkdirAll(buildDir, os.ModePerm); err != nil {
 		return env, fmt.Errorf("failed to create build directory: %w", err)
 	}
+	env.buildDir = buildDir
+	ctx = env.Context(ctx)
 
-	env.tf, err = setUpTerraform(ctx, terraformPath, buildDir)
-	if err != nil {
-		return env, fmt.Errorf("could not create terraform instance: %w", err)
+	if err := env.setUpVars(false); err != nil {
+		return env, err
 	}
 
-	if env.verbose {
-		env.tf.SetStdout(os.Stdout)
-		env.tf.SetStderr(os.Stderr)
+	// Use envtest instead of terraform if configured.
+	if env.envtest != nil {
+		if err := env.startLocal(ctx, scheme, kubeconfigPath); err != nil {
+			err = errors.Join(err, env.Stop(context.Background()))
+			return env, fmt.Errorf("error starting local environment: %w", err)
+		}
+		return env, nil
 	}
 
-	log.Println("Init Terraform")
-	err = env.tf.Init(ctx, tfexec.Upgrade(true))
+	start := time.Now()
+	initCtx, initCancel := phaseContext(ctx, env.timeouts.Init)
+	err = env.initTerraform(initCtx, terraformPath, buildDir)
+	initCancel()
 	if err != nil {
-		return env, fmt.Errorf("error running init: %w", err)
-	}
-
-	// Exit the test when existing state is found if -existing flag is false.
-	if !env.existing {
-		log.Println("Checking for an empty Terraform state")
-		state, err := env.tf.Show(ctx)
-		if err != nil {
-			return env, fmt.Errorf("could not read state: %v", err)
-		}
-		if state.Values != nil {
-			log.Println("Found existing resources, likely from previous unsuccessful run, cleaning up...")
-			return env, fmt.Errorf("expected an empty state but got existing resources")
-		}
+		return env, phaseError(initCtx, "init", env.timeouts.Init, err)
 	}
+	env.logPhaseDone("init", start)
 
 	// Set up signal handling to gracefully stop the environment.
 	sigs := make(chan os.Signal, 2)
@@ -193,101 +341,343 @@ func New(ctx context.Context, scheme *runtime.Scheme, terraformPath string, kube
 	go func() {
 		// Cancel the resource provisioning on first signal.
 		s := <-sigs
-		log.Println("Received signal:", s)
+		env.Logger().Info("Received signal", "signal", s.String())
 		infoMsg := "Attempting to gracefully stop terraform"
 		if !env.retain {
 			infoMsg += " and clean up"
 		}
-		log.Println(infoMsg)
+		env.Logger().Info(infoMsg)
 		cancel()
 
 		// Exit on second signal.
 		<-sigs
-		log.Println("Force stop")
+		env.Logger().Info("Force stop")
 		os.Exit(1)
 	}()
 
 	if err := env.createAndConfigure(ctx, scheme, kubeconfigPath); err != nil {
+		// Nothing was applied when the plan is rejected, leave the
+		// infrastructure as is.
+		if errors.Is(err, ErrPlanRejected) {
+			return env, err
+		}
 		// Clean up the partially provisioned resources on failure based on the
 		// environment configuation. In CI, this would ensure that if the CI job
 		// is cancelled, the resources get cleaned up.
 		err = errors.Join(err, env.Stop(context.Background()))
-		return env, fmt.Errorf("error running apply: %v", err)
+		return env, fmt.Errorf("error running apply: %w", err)
 	}
 
 	return env, nil
 }
 
-// setUpTerraform finds or downloads terraform binary and returns Terraform
-// which can be used to run terraform operations.
-func setUpTerraform(ctx context.Context, terraformPath string, buildDir string) (*tfexec.Terraform, error) {
-	// Find or download terraform binary.
-	i := install.NewInstaller()
-	execPath, err := i.Ensure(ctx, []src.Source{
-		&fs.AnyVersion{
-			Product: &product.Terraform,
-		},
-		&releases.LatestVersion{
-			Product:    product.Terraform,
-			InstallDir: buildDir,
-		},
-	})
+// initTerraform sets up terraform, runs init and selects the workspace of the
+// Environment. Unless the Environment uses the existing infrastructure, it
+// ensures that the terraform state is empty.
+func (env *Environment) initTerraform(ctx context.Context, terraformPath, buildDir string) error {
+	var err error
+	env.tf, err = env.setUpTerraform(ctx, terraformPath, buildDir)
+	if err != nil {
+		return fmt.Errorf("could not create terraform instance: %w", err)
+	}
+
+	logger := env.phaseLogger("init")
+	logger.Info("Init Terraform")
+	stopOutput := env.phaseOutput("init")
+	err = env.tf.Init(ctx, tfexec.Upgrade(true))
+	if err != nil {
+		stopOutput()
+		return fmt.Errorf("error running init: %w", err)
+	}
+
+	// Reuse the recorded workspace of the existing infrastructure.
+	if err := env.resolveWorkspace(buildDir, !env.existing); err != nil {
+		stopOutput()
+		return err
+	}
+	err = env.selectWorkspace(ctx, true)
+	stopOutput()
+	if err != nil {
+		return fmt.Errorf("failed to select workspace: %w", err)
+	}
+
+	// Exit the test when existing state is found if -existing flag is false.
+	if !env.existing {
+		logger.Info("Checking for an empty Terraform state")
+		state, err := env.tf.Show(ctx)
+		if err != nil {
+			return fmt.Errorf("could not read state: %v", err)
+		}
+		if state.Values != nil {
+			logger.Info("Found existing resources, likely from previous unsuccessful run, cleaning up...")
+			return fmt.Errorf("expected an empty state but got existing resources")
+		}
+	}
+
+	return nil
+}
+
+// setUpTerraform finds or downloads terraform binary, or the tofu binary if
+// configured, and returns Terraform which can be used to run terraform
+// operations. If a version constraint is configured, only a binary satisfying
+// it is used. Downloads are checksum verified and installed in the install
+// directory, which defaults to the build directory. A binary found in the
+// install directory is reused.
+func (env *Environment) setUpTerraform(ctx context.Context, terraformPath string, buildDir string) (*tfexec.Terraform, error) {
+	installDir := buildDir
+	if env.tfInstallDir != "" {
+		installDir = env.tfInstallDir
+		if err := os.MkdirAll(installDir, os.ModePerm); err != nil {
+			return nil, fmt.Errorf("failed to create terraform install directory: %w", err)
+		}
+	}
+
+	var constraints version.Constraints
+	if env.tfVersion != "" {
+		var err error
+		constraints, err = version.NewConstraint(env.tfVersion)
+		if err != nil {
+			return nil, fmt.Errorf("invalid terraform version constraint %q: %w", env.tfVersion, err)
+		}
+	}
+
+	binary := product.Terraform.Name
+	var execPath string
+	var err error
+	if env.tofu {
+		binary = tofuBinaryName
+		execPath, err = ensureTofu(ctx, installDir, env.tfReleasesURL, constraints)
+	} else {
+		execPath, err = ensureTerraform(ctx, installDir, env.tfReleasesURL, constraints)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("terraform exec path not found: %w", err)
+		return nil, fmt.Errorf("no %s binary matching version %q found in PATH or %s, and download failed: %w",
+			binary, env.tfVersion, installDir, err)
+	}
+	env.phaseLogger("init").Info("Using binary", "binary", binary, "path", execPath)
+
+	tf, err := tfexec.NewTerraform(terraformPath, execPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := setDataDir(tf, buildDir); err != nil {
+		return nil, fmt.Errorf("failed to set terraform data directory: %w", err)
 	}
-	log.Println("Terraform binary: ", execPath)
+	return tf, nil
+}
 
-	return tfexec.NewTerraform(terraformPath, execPath)
+// ensureTerraform finds a terraform binary satisfying the version constraints
+// or downloads one from the given releases URL, which defaults to
+// https://releases.hashicorp.com.
+func ensureTerraform(ctx context.Context, installDir, releasesURL string, constraints version.Constraints) (string, error) {
+	var sources []src.Source
+	if constraints != nil {
+		sources = append(sources, &fs.Version{
+			Product:     product.Terraform,
+			Constraints: constraints,
+			ExtraPaths:  []string{installDir},
+		})
+	} else {
+		sources = append(sources, &fs.AnyVersion{
+			Product:    &product.Terraform,
+			ExtraPaths: []string{installDir},
+		})
+	}
+	sources = append(sources, &releases.LatestVersion{
+		Product:     product.Terraform,
+		Constraints: constraints,
+		InstallDir:  installDir,
+		ApiBaseURL:  releasesURL,
+	})
+
+	i := install.NewInstaller()
+	return i.Ensure(ctx, sources)
 }
 
 // createAndConfigure creates the resources and configures the Environment with
 // the created resource.
 func (env *Environment) createAndConfigure(ctx context.Context, scheme *runtime.Scheme, kubeconfigPath string) error {
 	// Apply Terraform, read the output values and construct kubeconfig.
-	log.Println("Applying Terraform")
-	err := env.tf.Apply(ctx, env.tfApplyOptions...)
-	if err != nil {
-		return fmt.Errorf("error running apply: %v", err)
+	start := time.Now()
+	applyCtx, applyCancel := phaseContext(ctx, env.timeouts.Apply)
+	defer applyCancel()
+	if err := env.applyWithRetries(applyCtx); err != nil {
+		return phaseError(applyCtx, "apply", env.timeouts.Apply, err)
 	}
-	state, err := env.tf.Show(ctx)
+	env.logPhaseDone("apply", start)
+	state, err := env.tf.Show(applyCtx)
 	if err != nil {
 		return fmt.Errorf("could not read state: %v", err)
 	}
-	outputs := state.Values.Outputs
-	if err = env.CreateKubeconfig(ctx, outputs, kubeconfigPath); err != nil {
-		return fmt.Errorf("failed to create kubeconfig: %w", err)
+	if err := env.runAfterApplyHooks(ctx, state.Values.Outputs); err != nil {
+		return err
+	}
+
+	start = time.Now()
+	kcCtx, kcCancel := phaseContext(ctx, env.timeouts.Kubeconfig)
+	defer kcCancel()
+	err = env.configure(kcCtx, scheme, state.Values.Outputs, kubeconfigPath)
+	if err != nil {
+		return phaseError(kcCtx, "kubeconfig creation", env.timeouts.Kubeconfig, err)
+	}
+	env.logPhaseDone("kubeconfig", start)
+
+	if err := env.waitReady(ctx); err != nil {
+		return err
+	}
+	return env.runAfterReadyHooks(ctx)
+}
+
+// applyWithRetries runs apply and retries it with exponential backoff as long
+// as it fails with a retryable TerraformError.
+func (env *Environment) applyWithRetries(ctx context.Context) error {
+	for attempt := 0; ; attempt++ {
+		err := env.apply(ctx)
+		var tfErr *TerraformError
+		if err == nil || attempt >= env.applyRetries || !errors.As(err, &tfErr) || !tfErr.Retryable() {
+			return err
+		}
+
+		delay := env.applyBackoff << attempt
+		env.phaseLogger("apply").Info("Apply failed, retrying", "class", tfErr.Class, "delay", delay,
+			"attempt", attempt+1, "retries", env.applyRetries)
+		select {
+		case <-ctx.Done():
+			return errors.Join(err, ctx.Err())
+		case <-time.After(delay):
+		}
+	}
+}
+
+// apply runs terraform apply, after running plan if configured. Terraform
+// errors are returned as TerraformError.
+func (env *Environment) apply(ctx context.Context) error {
+	applyOpts := env.tfApplyOptions
+	if env.planEnabled {
+		planPath, err := env.runPlan(ctx)
+		if err != nil {
+			return err
+		}
+		applyOpts = append(savedPlanApplyOptions(env.tfApplyOptions), tfexec.DirOrPlan(planPath))
+	}
+
+	env.phaseLogger("apply").Info("Applying Terraform")
+	stopOutput := env.phaseOutput("apply")
+	defer stopOutput()
+	if err := env.tf.Apply(ctx, applyOpts...); err != nil {
+		return fmt.Errorf("error running apply: %w", classifyError(err))
+	}
+	return nil
+}
+
+// configure creates the kubeconfig using the given state outputs and
+// configures the clients of the Environment. If multiple clusters are
+// configured, a kubeconfig and clients are created for every cluster.
+func (env *Environment) configure(ctx context.Context, scheme *runtime.Scheme, outputs map[string]*tfjson.StateOutput, kubeconfigPath string) error {
+	if env.splitClusters == nil {
+		c, err := env.newCluster(ctx, scheme, "", outputs, kubeconfigPath)
+		if err != nil {
+			return err
+		}
+		env.setDefaultCluster(c)
+		return nil
+	}
+	return env.configureClusters(ctx, scheme, outputs, kubeconfigPath)
+}
+
+// newCluster creates the kubeconfig of a cluster at the given path using the
+// given state outputs and returns the cluster with its clients.
+func (env *Environment) newCluster(ctx context.Context, scheme *runtime.Scheme, name string, outputs map[string]*tfjson.StateOutput, kubeconfigPath string) (*Cluster, error) {
+	if env.provider != nil {
+		if err := ValidateOutputs(env.provider, OperationKubeconfig, outputs); err != nil {
+			return nil, err
+		}
+	}
+	if err := env.CreateKubeconfig(ctx, outputs, kubeconfigPath); err != nil {
+		return nil, fmt.Errorf("failed to create kubeconfig: %w", err)
 	}
 
 	// Create kube client.
 	kubeCfg, err := clientcmd.BuildConfigFromFlags("", kubeconfigPath)
 	if err != nil {
-		return fmt.Errorf("failed to build rest config: %w", err)
+		return nil, fmt.Errorf("failed to build rest config: %w", err)
 	}
-	env.Client, err = client.New(kubeCfg, client.Options{Scheme: scheme})
+	if env.CreateTokenSource != nil {
+		// The token source is used by the clients after New returns.
+		ts, err := env.CreateTokenSource(context.WithoutCancel(ctx), outputs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create token source: %w", err)
+		}
+		// Replace the kubeconfig credentials with the token source.
+		kubeCfg.BearerToken = ""
+		kubeCfg.BearerTokenFile = ""
+		kubeCfg.ExecProvider = nil
+		kubeCfg.AuthProvider = nil
+		kubeCfg.Wrap(transport.TokenSourceWrapTransport(ts))
+	}
+
+	c := &Cluster{
+		Name:           name,
+		KubeconfigPath: kubeconfigPath,
+		Config:         kubeCfg,
+	}
+	c.Client, err = client.New(kubeCfg, client.Options{Scheme: scheme})
 	if err != nil {
-		return fmt.Errorf("failed to create new client: %w", err)
+		return nil, fmt.Errorf("failed to create new client: %w", err)
 	}
-	env.ClientGo, err = kubernetes.NewForConfig(kubeCfg)
+	c.ClientGo, err = kubernetes.NewForConfig(kubeCfg)
 	if err != nil {
-		return fmt.Errorf("failed to create client-go client: %w", err)
+		return nil, fmt.Errorf("failed to create client-go client: %w", err)
 	}
 
-	return nil
+	return c, nil
+}
+
+// setDefaultCluster sets the clients of the Environment to the clients of
+// the given cluster.
+func (env *Environment) setDefaultCluster(c *Cluster) {
+	env.Client = c.Client
+	env.ClientGo = c.ClientGo
+	env.Config = c.Config
 }
 
 // Stop tears down the test infrastructure created by the environment.
 func (env *Environment) Stop(ctx context.Context) error {
-	if !env.retain {
-		log.Println("Destroying environment...")
-		if ferr := env.tf.Destroy(ctx, env.tfDestroyOptions...); ferr != nil {
-			return fmt.Errorf("could not destroy infrastructure: %w", ferr)
-		}
+	if env.retain && env.envtest == nil {
+		return nil
 	}
-	return nil
+	ctx = env.Context(ctx)
+
+	env.runDiagnosticsOnFailure(ctx)
+
+	ctx, cancel := env.destroyContext(ctx)
+	defer cancel()
+	hookErr := env.runBeforeDestroyHooks(ctx)
+	var err error
+	if env.envtest != nil {
+		err = env.stopLocal()
+	} else {
+		hookErr = errors.Join(hookErr, env.cleanupCloudObjects(ctx))
+		env.phaseLogger("destroy").Info("Destroying environment...")
+		err = env.destroy(ctx)
+	}
+	if hookErr != nil {
+		return errors.Join(hookErr, err)
+	}
+	return err
+}
+
+// Provider returns the Provider of the environment, if configured with
+// WithProvider.
+func (env *Environment) Provider() Provider {
+	return env.provider
 }
 
 // State queries and returns the current state output of terraform.
 func (env *Environment) StateOutput(ctx context.Context) (map[string]*tfjson.StateOutput, error) {
+	if env.localOutputs != nil {
+		return env.localOutputs, nil
+	}
 	state, err := env.tf.Show(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("could not read state: %v", err)
@@ -307,9 +697,6 @@ func (env *Environment) StateOutput(ctx context.Context) (map[string]*tfjson.Sta
 // and the whole process gets terminated. This can be run in a separate step in
 // CI to destroy the infrastructure.
 func Destroy(ctx context.Context, terraformPath string, opts ...EnvironmentOption) error {
-	// Set a default logger if not set already.
-	runtimeLog.SetLogger(klogr.New())
-
 	env := &Environment{
 		buildDir: "build", // Default build dir.
 	}
@@ -318,6 +705,7 @@ func Destroy(ctx context.Context, terraformPath string, opts ...EnvironmentOptio
 	for _, opt := range opts {
 		opt(env)
 	}
+	ctx = env.setUpLogger(ctx)
 
 	// Assume that the initial test run created the build directory.
 	cwd, err := os.Getwd()
@@ -325,17 +713,34 @@ func Destroy(ctx context.Context, terraformPath string, opts ...EnvironmentOptio
 		return fmt.Errorf("failed to get the current working directory: %w", err)
 	}
 	buildDir := filepath.Join(cwd, env.buildDir)
+	env.buildDir = buildDir
+	ctx = env.Context(ctx)
+
+	if err := env.setUpVars(true); err != nil {
+		return err
+	}
 
-	env.tf, err = setUpTerraform(ctx, terraformPath, buildDir)
+	env.tf, err = env.setUpTerraform(ctx, terraformPath, buildDir)
 	if err != nil {
 		return fmt.Errorf("could not create terraform instance: %w", err)
 	}
 
-	if env.verbose {
-		env.tf.SetStdout(os.Stdout)
-		env.tf.SetStderr(os.Stderr)
+	if err := env.resolveWorkspace(buildDir, false); err != nil {
+		return err
 	}
+	if err := env.selectWorkspace(ctx, false); err != nil {
+		return fmt.Errorf("failed to select workspace: %w", err)
+	}
+
+	ctx, cancel := env.destroyContext(ctx)
+	defer cancel()
+	env.configureForDestroy(ctx)
+	hookErr := errors.Join(env.runBeforeDestroyHooks(ctx), env.cleanupCloudObjects(ctx))
 
-	log.Println("Terraform destroy...")
-	return env.tf.Destroy(ctx, env.tfDestroyOptions...)
+	env.phaseLogger("destroy").Info("Terraform destroy...")
+	err = env.destroy(ctx)
+	if hookErr != nil {
+		return errors.Join(hookErr, err)
+	}
+	return err
 }
@@ -0,0 +1,197 @@
+/*
+Copyright 2026 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tftestenv
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	. "github.com/onsi/gomega"
+	"golang.org/x/oauth2"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+)
+
+// fakeTerraform is a script that reports the terraform version like the
+// terraform binary does.
+const fakeTerraform = `#!/bin/sh
+echo '{"terraform_version":"1.5.7","platform":"linux_amd64","provider_selections":{},"terraform_outdated":false}'
+`
+
+func TestSetUpTerraform(t *testing.T) {
+	// Count the requests to the release mirror, which is always unavailable
+	// like on an air-gapped runner.
+	var mirrorHits int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mirrorHits++
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name       string
+		constraint string
+		wantErr    string
+		wantCached bool
+	}{
+		{
+			name:       "cached binary satisfies constraint",
+			constraint: "~> 1.5.0",
+			wantCached: true,
+		},
+		{
+			name:       "cached binary without constraint",
+			wantCached: true,
+		},
+		{
+			name:       "unsatisfiable constraint offline",
+			constraint: "= 1.6.0",
+			wantErr:    `no terraform binary matching version "= 1.6.0"`,
+		},
+		{
+			name:       "invalid constraint",
+			constraint: "foo",
+			wantErr:    "invalid terraform version constraint",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			mirrorHits = 0
+			// Ensure that no terraform binary is found in PATH.
+			t.Setenv("PATH", t.TempDir())
+
+			installDir := t.TempDir()
+			binPath := filepath.Join(installDir, "terraform")
+			g.Expect(os.WriteFile(binPath, []byte(fakeTerraform), 0o755)).To(Succeed())
+
+			env := &Environment{}
+			opts := []EnvironmentOption{
+				WithTerraformVersion(tt.constraint),
+				WithTerraformInstallDir(installDir),
+				WithTerraformReleasesURL(srv.URL),
+			}
+			for _, opt := range opts {
+				opt(env)
+			}
+
+			tf, err := env.setUpTerraform(context.TODO(), t.TempDir(), t.TempDir())
+			if tt.wantErr != "" {
+				g.Expect(err).To(MatchError(ContainSubstring(tt.wantErr)))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(tf.ExecPath()).To(Equal(binPath))
+			if tt.wantCached {
+				g.Expect(mirrorHits).To(BeZero())
+			}
+		})
+	}
+}
+
+// discoveryAPIServer returns a Kubernetes API stand-in serving the discovery
+// endpoints, which records the Authorization headers of the requests.
+func discoveryAPIServer(authorizations *[]string) *httptest.Server {
+	var mu sync.Mutex
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		*authorizations = append(*authorizations, r.Header.Get("Authorization"))
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api":
+			fmt.Fprint(w, `{"kind":"APIVersions","versions":["v1"]}`)
+		case "/apis":
+			fmt.Fprint(w, `{"kind":"APIGroupList","groups":[]}`)
+		case "/api/v1":
+			fmt.Fprint(w, `{"kind":"APIResourceList","groupVersion":"v1","resources":[]}`)
+		case "/version":
+			fmt.Fprint(w, `{"major":"1","minor":"24","gitVersion":"v1.24.1"}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+// staticKubeconfig returns a CreateKubeconfig which writes a kubeconfig for
+// the given server with a static token.
+func staticKubeconfig(server string) CreateKubeconfig {
+	return func(ctx context.Context, state map[string]*tfjson.StateOutput, kcPath string) error {
+		return os.WriteFile(kcPath, []byte(testKubeconfig(server, "static")), 0o600)
+	}
+}
+
+// testKubeconfig returns a kubeconfig for the given server with the given
+// static token.
+func testKubeconfig(server, token string) string {
+	return fmt.Sprintf(`apiVersion: v1
+kind: Config
+clusters:
+- cluster:
+    server: %s
+  name: test
+contexts:
+- context:
+    cluster: test
+    user: test
+  name: test
+current-context: test
+users:
+- name: test
+  user:
+    token: %s
+`, server, token)
+}
+
+func TestNewCluster_tokenSource(t *testing.T) {
+	g := NewWithT(t)
+
+	var authorizations []string
+	srv := discoveryAPIServer(&authorizations)
+	defer srv.Close()
+
+	var tsCtx context.Context
+	env := &Environment{}
+	WithTokenSource(func(ctx context.Context, state map[string]*tfjson.StateOutput) (oauth2.TokenSource, error) {
+		tsCtx = ctx
+		return oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "from-token-source"}), nil
+	})(env)
+	env.CreateKubeconfig = staticKubeconfig(srv.URL)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c, err := env.newCluster(ctx, clientgoscheme.Scheme, "", nil, filepath.Join(t.TempDir(), "kubeconfig"))
+	g.Expect(err).ToNot(HaveOccurred())
+	_, err = c.ClientGo.Discovery().ServerVersion()
+	g.Expect(err).ToNot(HaveOccurred())
+
+	// The token source replaces the kubeconfig credentials.
+	g.Expect(authorizations).ToNot(BeEmpty())
+	for _, a := range authorizations {
+		g.Expect(a).To(Equal("Bearer from-token-source"))
+	}
+
+	// The context of the token source outlives the set up.
+	cancel()
+	g.Expect(tsCtx.Err()).ToNot(HaveOccurred())
+}
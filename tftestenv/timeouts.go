@@ -0,0 +1,90 @@
+/*
+Copyright 2026 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tftestenv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Timeouts are the time budgets of the phases of the environment. A zero
+// value means that the phase is only bound by the context it runs with, except
+// for destroy which then has a default budget.
+type Timeouts struct {
+	// Init is the budget for installing terraform, running init and selecting
+	// the workspace.
+	Init time.Duration
+	// Apply is the budget for running plan and apply, including the retries.
+	Apply time.Duration
+	// Kubeconfig is the budget for creating the kubeconfig and the clients.
+	Kubeconfig time.Duration
+	// Destroy is the budget for tearing down the environment: the before
+	// destroy hooks, the cloud-backed objects cleanup and running destroy,
+	// including the retries. Unlike the other phases, destroy always gets a
+	// fresh budget that isn't cancelled along with the context it runs with,
+	// so that the infrastructure is cleaned up even after the apply was
+	// cancelled by a timeout or a shutdown signal. It defaults to 30 minutes.
+	Destroy time.Duration
+}
+
+// defaultDestroyTimeout is the destroy budget used when none is configured.
+const defaultDestroyTimeout = 30 * time.Minute
+
+// WithTimeouts configures the time budgets of the phases of the environment.
+// Set them so that a stuck phase fails before the go test timeout, leaving
+// time to destroy the infrastructure.
+func WithTimeouts(t Timeouts) EnvironmentOption {
+	return func(e *Environment) {
+		e.timeouts = t
+	}
+}
+
+// phaseContext returns a context for a phase with the given timeout, or the
+// given context if the timeout is zero.
+func phaseContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout == 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// destroyContext returns a context for the destroy phase with the destroy
+// budget. The context isn't cancelled along with the given context. It's
+// shared by all the teardown steps, so that they don't exceed the budget
+// together.
+func (env *Environment) destroyContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.WithoutCancel(ctx), env.destroyTimeout())
+}
+
+// destroyTimeout returns the destroy budget of the environment.
+func (env *Environment) destroyTimeout() time.Duration {
+	if env.timeouts.Destroy == 0 {
+		return defaultDestroyTimeout
+	}
+	return env.timeouts.Destroy
+}
+
+// phaseError annotates the given error of a phase if the phase ran out of its
+// time budget.
+func phaseError(ctx context.Context, phase string, timeout time.Duration, err error) error {
+	if err != nil && timeout > 0 && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%s timed out after %s: %w", phase, timeout, err)
+	}
+	return err
+}
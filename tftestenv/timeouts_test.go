@@ -0,0 +1,123 @@
+/*
+Copyright 2026 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tftestenv
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform-exec/tfexec"
+	. "github.com/onsi/gomega"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestDestroyContext(t *testing.T) {
+	g := NewWithT(t)
+
+	// The parent context is cancelled, like after an apply timeout or a
+	// shutdown signal.
+	parent, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	env := &Environment{}
+	ctx, done := env.destroyContext(parent)
+	g.Expect(ctx.Err()).ToNot(HaveOccurred())
+	deadline, ok := ctx.Deadline()
+	g.Expect(ok).To(BeTrue())
+	g.Expect(deadline).To(BeTemporally("~", time.Now().Add(defaultDestroyTimeout), time.Second))
+	done()
+
+	WithTimeouts(Timeouts{Destroy: time.Minute})(env)
+	ctx, done = env.destroyContext(parent)
+	defer done()
+	g.Expect(ctx.Err()).ToNot(HaveOccurred())
+	deadline, ok = ctx.Deadline()
+	g.Expect(ok).To(BeTrue())
+	g.Expect(deadline).To(BeTemporally("~", time.Now().Add(time.Minute), time.Second))
+}
+
+func TestPhaseError(t *testing.T) {
+	g := NewWithT(t)
+
+	ctx, cancel := phaseContext(context.Background(), time.Millisecond)
+	defer cancel()
+	<-ctx.Done()
+
+	err := errors.New("signal: killed")
+	g.Expect(phaseError(ctx, "apply", time.Millisecond, err)).To(MatchError("apply timed out after 1ms: signal: killed"))
+	g.Expect(phaseError(context.Background(), "apply", time.Millisecond, err)).To(Equal(err))
+	g.Expect(phaseError(ctx, "apply", time.Millisecond, nil)).To(Succeed())
+}
+
+func TestDestroyCancelledParent(t *testing.T) {
+	g := NewWithT(t)
+
+	dir := t.TempDir()
+	tf := destroyTerraform(t, dir)
+
+	parent, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	env := &Environment{tf: tf, buildDir: dir}
+	g.Expect(env.Stop(parent)).To(Succeed())
+	g.Expect(filepath.Join(dir, "destroyed")).To(BeAnExistingFile())
+}
+
+func TestStopSharedDestroyBudget(t *testing.T) {
+	g := NewWithT(t)
+
+	dir := t.TempDir()
+	env := &Environment{tf: destroyTerraform(t, dir), buildDir: dir}
+	env.Client = fake.NewClientBuilder().Build()
+
+	// The before destroy hook uses up the whole destroy budget, which leaves
+	// none for destroy.
+	opts := []EnvironmentOption{
+		WithTimeouts(Timeouts{Destroy: 100 * time.Millisecond}),
+		WithHooks(Hooks{BeforeDestroy: func(ctx context.Context, env *Environment) error {
+			<-ctx.Done()
+			return nil
+		}}),
+	}
+	for _, opt := range opts {
+		opt(env)
+	}
+
+	err := env.Stop(context.Background())
+	g.Expect(err).To(MatchError(ContainSubstring("destroy timed out after 100ms")))
+	g.Expect(filepath.Join(dir, "destroyed")).ToNot(BeAnExistingFile())
+}
+
+// destroyTerraform returns a terraform stand-in working in the given directory,
+// which creates the file "destroyed" in it when running destroy.
+func destroyTerraform(t *testing.T, dir string) *tfexec.Terraform {
+	t.Helper()
+	tfPath := filepath.Join(dir, "terraform")
+	script := "#!/bin/sh\nif [ \"$1\" = destroy ]; then touch \"" + filepath.Join(dir, "destroyed") + "\"; fi\n"
+	if err := os.WriteFile(tfPath, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	tf, err := tfexec.NewTerraform(dir, tfPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tf
+}
@@ -0,0 +1,292 @@
+/*
+Copyright 2026 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tftestenv
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/hashicorp/go-version"
+)
+
+const (
+	// tofuBinaryName is the name of the OpenTofu binary.
+	tofuBinaryName = "tofu"
+	// tofuVersionsURL is the URL of the OpenTofu versions API.
+	tofuVersionsURL = "https://get.opentofu.org/tofu/api.json"
+	// tofuDownloadURL is the base URL of the OpenTofu release artifacts.
+	tofuDownloadURL = "https://github.com/opentofu/opentofu/releases/download"
+	// tofuKeyURL is the URL of the OpenTofu release signing key.
+	tofuKeyURL = "https://get.opentofu.org/opentofu.asc"
+)
+
+// tofuKeyFingerprint is the fingerprint of the OpenTofu release signing key,
+// as published in the OpenTofu installer. The key downloaded from tofuKeyURL
+// or from the releases mirror must match it.
+var tofuKeyFingerprint = "E3E6E43D84CB852EADB0051D0C0AF313E5FD9F80"
+
+// WithTofu configures the Environment to use OpenTofu instead of terraform.
+// The tofu binary is located and installed like the terraform binary, and the
+// version constraint, install directory and releases URL options apply to it.
+func WithTofu(tofu bool) EnvironmentOption {
+	return func(e *Environment) {
+		e.tofu = tofu
+	}
+}
+
+// findTofu returns the path of a tofu binary in the install directory or in
+// PATH which satisfies the given version constraints, if any. Candidates whose
+// version can't be determined are skipped.
+func findTofu(ctx context.Context, installDir string, constraints version.Constraints) (string, error) {
+	candidates := []string{filepath.Join(installDir, tofuBinaryName)}
+	if p, err := exec.LookPath(tofuBinaryName); err == nil {
+		candidates = append(candidates, p)
+	}
+	var errs []error
+	for _, p := range candidates {
+		if _, err := os.Stat(p); err != nil {
+			continue
+		}
+		v, err := tofuVersion(ctx, p)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if constraints == nil || constraints.Check(v) {
+			return p, nil
+		}
+	}
+	return "", errors.Join(append([]error{fmt.Errorf("no tofu binary found")}, errs...)...)
+}
+
+// tofuVersion returns the version of the given tofu binary.
+func tofuVersion(ctx context.Context, execPath string) (*version.Version, error) {
+	out, err := exec.CommandContext(ctx, execPath, "version", "-json").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get version of %s: %w", execPath, err)
+	}
+	var v struct {
+		// OpenTofu keeps the terraform output format.
+		Version string `json:"terraform_version"`
+	}
+	if err := json.Unmarshal(out, &v); err != nil {
+		return nil, fmt.Errorf("failed to parse version of %s: %w", execPath, err)
+	}
+	return version.NewVersion(v.Version)
+}
+
+// latestTofuVersion returns the latest stable OpenTofu version which satisfies
+// the given version constraints, if any, from the versions API.
+func latestTofuVersion(ctx context.Context, versionsURL string, constraints version.Constraints) (*version.Version, error) {
+	body, err := httpGet(ctx, versionsURL)
+	if err != nil {
+		return nil, err
+	}
+	var index struct {
+		Versions []struct {
+			ID string `json:"id"`
+		} `json:"versions"`
+	}
+	if err := json.Unmarshal(body, &index); err != nil {
+		return nil, fmt.Errorf("failed to parse OpenTofu versions: %w", err)
+	}
+
+	var versions version.Collection
+	for _, v := range index.Versions {
+		ver, err := version.NewVersion(v.ID)
+		if err != nil || ver.Prerelease() != "" {
+			continue
+		}
+		if constraints == nil || constraints.Check(ver) {
+			versions = append(versions, ver)
+		}
+	}
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("no OpenTofu version found")
+	}
+	sort.Sort(versions)
+	return versions[len(versions)-1], nil
+}
+
+// installTofu downloads the given version of OpenTofu, verifies the signature
+// of the checksums with the key at keyURL and the checksum of the archive, and
+// installs the binary in the install directory.
+func installTofu(ctx context.Context, downloadURL, keyURL string, v *version.Version, installDir string) (string, error) {
+	ver := v.String()
+	archive := fmt.Sprintf("tofu_%s_%s_%s.zip", ver, runtime.GOOS, runtime.GOARCH)
+	baseURL := fmt.Sprintf("%s/v%s", downloadURL, ver)
+
+	sumsURL := fmt.Sprintf("%s/tofu_%s_SHA256SUMS", baseURL, ver)
+	sums, err := httpGet(ctx, sumsURL)
+	if err != nil {
+		return "", err
+	}
+	sig, err := httpGet(ctx, sumsURL+".gpgsig")
+	if err != nil {
+		return "", err
+	}
+	if err := verifyTofuSignature(ctx, keyURL, sums, sig); err != nil {
+		return "", err
+	}
+
+	var wantSum string
+	scanner := bufio.NewScanner(bytes.NewReader(sums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[1] == archive {
+			wantSum = fields[0]
+		}
+	}
+	if wantSum == "" {
+		return "", fmt.Errorf("checksum of %s not found", archive)
+	}
+
+	data, err := httpGet(ctx, fmt.Sprintf("%s/%s", baseURL, archive))
+	if err != nil {
+		return "", err
+	}
+	gotSum := sha256.Sum256(data)
+	if hex.EncodeToString(gotSum[:]) != wantSum {
+		return "", fmt.Errorf("checksum mismatch of %s", archive)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", archive, err)
+	}
+	for _, f := range zr.File {
+		if f.Name != tofuBinaryName {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return "", err
+		}
+		defer rc.Close()
+
+		execPath := filepath.Join(installDir, tofuBinaryName)
+		if err := writeExecutable(execPath, rc); err != nil {
+			return "", fmt.Errorf("failed to install %s: %w", tofuBinaryName, err)
+		}
+		return execPath, nil
+	}
+	return "", fmt.Errorf("%s not found in %s", tofuBinaryName, archive)
+}
+
+// verifyTofuSignature verifies the detached signature of the checksums with
+// the key at keyURL, which must match tofuKeyFingerprint.
+func verifyTofuSignature(ctx context.Context, keyURL string, sums, sig []byte) error {
+	key, err := httpGet(ctx, keyURL)
+	if err != nil {
+		return err
+	}
+	keyring, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(key))
+	if err != nil {
+		return fmt.Errorf("failed to read OpenTofu signing key: %w", err)
+	}
+	var trusted openpgp.EntityList
+	for _, e := range keyring {
+		if strings.EqualFold(hex.EncodeToString(e.PrimaryKey.Fingerprint), tofuKeyFingerprint) {
+			trusted = append(trusted, e)
+		}
+	}
+	if len(trusted) == 0 {
+		return fmt.Errorf("OpenTofu signing key with fingerprint %s not found at %s", tofuKeyFingerprint, keyURL)
+	}
+	if _, err := openpgp.CheckDetachedSignature(trusted, bytes.NewReader(sums), bytes.NewReader(sig), nil); err != nil {
+		return fmt.Errorf("invalid signature of OpenTofu checksums: %w", err)
+	}
+	return nil
+}
+
+// writeExecutable writes the content of r to a temporary file next to the
+// given path and renames it into place, so that an interrupted install never
+// leaves a partial binary at path.
+func writeExecutable(path string, r io.Reader) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o755); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// ensureTofu finds a tofu binary satisfying the version constraints or
+// downloads one from the given releases URL. If the releases URL is set, it
+// must serve the versions API at api.json, the release signing key at
+// opentofu.asc and the release artifacts in the layout of the OpenTofu GitHub
+// releases.
+func ensureTofu(ctx context.Context, installDir, releasesURL string, constraints version.Constraints) (string, error) {
+	if execPath, err := findTofu(ctx, installDir, constraints); err == nil {
+		return execPath, nil
+	}
+
+	versionsURL, downloadURL, keyURL := tofuVersionsURL, tofuDownloadURL, tofuKeyURL
+	if releasesURL != "" {
+		releasesURL = strings.TrimSuffix(releasesURL, "/")
+		versionsURL, downloadURL, keyURL = releasesURL+"/api.json", releasesURL, releasesURL+"/opentofu.asc"
+	}
+	v, err := latestTofuVersion(ctx, versionsURL, constraints)
+	if err != nil {
+		return "", err
+	}
+	return installTofu(ctx, downloadURL, keyURL, v, installDir)
+}
+
+// httpGet returns the body of the given URL.
+func httpGet(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: unexpected status %s", url, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
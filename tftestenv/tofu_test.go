@@ -0,0 +1,233 @@
+/*
+Copyright 2026 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tftestenv
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/hashicorp/go-version"
+	. "github.com/onsi/gomega"
+)
+
+// fakeTofu returns a script that reports the given version like the tofu
+// binary does.
+func fakeTofu(v string) string {
+	return fmt.Sprintf(`#!/bin/sh
+echo '{"terraform_version":"%s","platform":"linux_amd64","provider_selections":{}}'
+`, v)
+}
+
+// newTofuSigningKey returns a new signing key and trusts it in place of the
+// OpenTofu release signing key for the duration of the test.
+func newTofuSigningKey(t *testing.T) *openpgp.Entity {
+	t.Helper()
+
+	e, err := openpgp.NewEntity("tftestenv", "", "", &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fingerprint := tofuKeyFingerprint
+	tofuKeyFingerprint = hex.EncodeToString(e.PrimaryKey.Fingerprint)
+	t.Cleanup(func() { tofuKeyFingerprint = fingerprint })
+	return e
+}
+
+// tofuReleases configures the content served by newTofuReleasesServer.
+type tofuReleases struct {
+	// key signs the checksums and is served as the release signing key.
+	key *openpgp.Entity
+	// signer signs the checksums instead of key, if set.
+	signer *openpgp.Entity
+	// corruptSums serves checksums which don't match the archives.
+	corruptSums bool
+}
+
+// newTofuReleasesServer returns a server that serves the OpenTofu versions API,
+// the release signing key and the release artifacts of the given versions.
+func newTofuReleasesServer(t *testing.T, releases tofuReleases, versions ...string) *httptest.Server {
+	t.Helper()
+
+	signer := releases.key
+	if releases.signer != nil {
+		signer = releases.signer
+	}
+
+	mux := http.NewServeMux()
+	var key bytes.Buffer
+	aw, err := armor.Encode(&key, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := releases.key.Serialize(aw); err != nil {
+		t.Fatal(err)
+	}
+	if err := aw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	mux.HandleFunc("/opentofu.asc", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(key.Bytes())
+	})
+	index := `{"versions":[`
+	for i, v := range versions {
+		if i > 0 {
+			index += ","
+		}
+		index += fmt.Sprintf(`{"id":%q}`, v)
+
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		f, err := zw.Create(tofuBinaryName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprint(f, fakeTofu(v))
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		archive := fmt.Sprintf("tofu_%s_%s_%s.zip", v, runtime.GOOS, runtime.GOARCH)
+		sum := sha256.Sum256(buf.Bytes())
+		if releases.corruptSums {
+			sum = sha256.Sum256([]byte("corrupt"))
+		}
+		data := buf.Bytes()
+		mux.HandleFunc(fmt.Sprintf("/v%s/%s", v, archive), func(w http.ResponseWriter, r *http.Request) {
+			w.Write(data)
+		})
+		sums := fmt.Sprintf("%s  %s\n", hex.EncodeToString(sum[:]), archive)
+		mux.HandleFunc(fmt.Sprintf("/v%s/tofu_%s_SHA256SUMS", v, v), func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, sums)
+		})
+		var sig bytes.Buffer
+		if err := openpgp.DetachSign(&sig, signer, bytes.NewBufferString(sums), nil); err != nil {
+			t.Fatal(err)
+		}
+		mux.HandleFunc(fmt.Sprintf("/v%s/tofu_%s_SHA256SUMS.gpgsig", v, v), func(w http.ResponseWriter, r *http.Request) {
+			w.Write(sig.Bytes())
+		})
+	}
+	index += "]}"
+	mux.HandleFunc("/api.json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, index)
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestEnsureTofu(t *testing.T) {
+	key := newTofuSigningKey(t)
+	untrusted, err := openpgp.NewEntity("untrusted", "", "", &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		constraint  string
+		releases    tofuReleases
+		brokenTofu  bool
+		wantVersion string
+		wantErr     string
+	}{
+		{
+			name:        "latest stable version",
+			wantVersion: "1.7.2",
+		},
+		{
+			name:        "version with constraint",
+			constraint:  "~> 1.6.0",
+			wantVersion: "1.6.1",
+		},
+		{
+			name:       "unsatisfiable constraint",
+			constraint: ">= 2.0",
+			wantErr:    "no OpenTofu version found",
+		},
+		{
+			name:     "checksum mismatch",
+			releases: tofuReleases{corruptSums: true},
+			wantErr:  "checksum mismatch",
+		},
+		{
+			name:     "checksums signed by another key",
+			releases: tofuReleases{signer: untrusted},
+			wantErr:  "invalid signature of OpenTofu checksums",
+		},
+		{
+			name:        "broken tofu in PATH is skipped",
+			brokenTofu:  true,
+			wantVersion: "1.7.2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			// Ensure that no working tofu binary is found in PATH.
+			pathDir := t.TempDir()
+			t.Setenv("PATH", pathDir)
+			if tt.brokenTofu {
+				g.Expect(os.WriteFile(filepath.Join(pathDir, tofuBinaryName), []byte("#!/bin/sh\nexit 1\n"), 0o755)).To(Succeed())
+			}
+
+			tt.releases.key = key
+			srv := newTofuReleasesServer(t, tt.releases, "1.6.1", "1.7.2", "1.8.0-beta1")
+			defer srv.Close()
+
+			var constraints version.Constraints
+			if tt.constraint != "" {
+				var err error
+				constraints, err = version.NewConstraint(tt.constraint)
+				g.Expect(err).ToNot(HaveOccurred())
+			}
+
+			installDir := t.TempDir()
+			execPath, err := ensureTofu(context.TODO(), installDir, srv.URL, constraints)
+			if tt.wantErr != "" {
+				g.Expect(err).To(MatchError(ContainSubstring(tt.wantErr)))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(execPath).To(Equal(filepath.Join(installDir, tofuBinaryName)))
+			entries, err := os.ReadDir(installDir)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(entries).To(HaveLen(1), "no temporary file is left in the install directory")
+
+			v, err := tofuVersion(context.TODO(), execPath)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(v.String()).To(Equal(tt.wantVersion))
+
+			// The installed binary is reused without downloading again.
+			srv.Close()
+			cachedPath, err := ensureTofu(context.TODO(), installDir, srv.URL, constraints)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(cachedPath).To(Equal(execPath))
+		})
+	}
+}
@@ -17,19 +17,27 @@ limitations under the License.
 package tftestenv
 
 import (
+	"archive/tar"
 	"bytes"
 	"context"
 	"fmt"
 	"io"
-	"log"
+	"math/rand"
 	"os"
 	"os/exec"
+	"sync"
 	"time"
 
 	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/google/go-containerregistry/pkg/name"
-	"github.com/google/go-containerregistry/pkg/v1/random"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/daemon"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"golang.org/x/sync/errgroup"
 )
 
 // CreatedAtTimeLayout is a time layout for the 'createdat' label/tag on cloud
@@ -110,6 +118,14 @@ func RunCommandWithOutput(ctx context.Context, dir, command string, opts RunComm
 		}
 	}
 
+	// Tee the output to the command log of the context, if any.
+	logWriters, closeLogs := commandOutput(ctx, opts.AttachConsole)
+	defer closeLogs()
+	outWriters = append(outWriters, logWriters...)
+	if !opts.StdoutOnly {
+		errWriters = append(errWriters, logWriters...)
+	}
+
 	outWr := io.MultiWriter(outWriters...)
 	errWr := io.MultiWriter(errWriters...)
 
@@ -119,57 +135,231 @@ func RunCommandWithOutput(ctx context.Context, dir, command string, opts RunComm
 		cmd.Stderr = errWr
 	}
 
+	logger := loggerFrom(ctx)
+	logger.V(1).Info("Running command", "command", command, "dir", dir)
+	start := time.Now()
 	err := cmd.Run()
+	logger.V(1).Info("Command completed", "command", command, "duration", time.Since(start).Round(time.Millisecond))
 	return output.Bytes(), err
 }
 
-// CreateAndPushImages randomly generates test images with the given tags and
-// pushes them to the given test repositories.
-func CreateAndPushImages(repos map[string]string, tags []string) error {
-	// TODO: Build and push concurrently.
+// PushImagesOptions is used to configure CreateAndPushImages.
+type PushImagesOptions struct {
+	// Concurrency is the maximum number of concurrent pushes. Defaults to 4.
+	Concurrency int
+	// Seed is the seed of the generated image content. The same seed always
+	// generates the same images.
+	Seed int64
+	// LayerSize is the size in bytes of the content of the image layer.
+	// Defaults to 1024.
+	LayerSize int64
+	// RemoteOptions are the options used to push the images. Defaults to the
+	// credentials of the host docker/podman client config.
+	RemoteOptions []remote.Option
+}
+
+// defaultPushImagesOptions adds default options of PushImagesOptions.
+func defaultPushImagesOptions(o *PushImagesOptions) {
+	if o.Concurrency <= 0 {
+		o.Concurrency = 4
+	}
+	if o.LayerSize <= 0 {
+		o.LayerSize = 1024
+	}
+	if len(o.RemoteOptions) == 0 {
+		o.RemoteOptions = []remote.Option{remote.WithAuthFromKeychain(authn.DefaultKeychain)}
+	}
+}
+
+// CreateAndPushImages generates test images with the given tags and pushes
+// them concurrently to the given test repositories. It returns the digest of
+// every pushed image reference. The images are deterministic: they share a
+// layer generated from the seed, so blobs are reused across tags, and only
+// differ by a config label with the tag.
+func CreateAndPushImages(ctx context.Context, repos map[string]string, tags []string, opts PushImagesOptions) (map[string]string, error) {
+	defaultPushImagesOptions(&opts)
+
+	layer, err := seededLayer(opts.Seed, opts.LayerSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create image layer: %w", err)
+	}
+	// Compute the digests before pushing, which also computes the lazily
+	// mutated images once instead of concurrently in the workers.
+	images := make(map[string]v1.Image, len(tags))
+	imageDigests := make(map[string]string, len(tags))
+	for _, tag := range tags {
+		if images[tag], err = seededImage(layer, tag); err != nil {
+			return nil, fmt.Errorf("failed to create image: %w", err)
+		}
+		digest, err := images[tag].Digest()
+		if err != nil {
+			return nil, fmt.Errorf("failed to compute image digest: %w", err)
+		}
+		imageDigests[tag] = digest.String()
+	}
+
+	var mu sync.Mutex
+	digests := make(map[string]string, len(repos)*len(tags))
+	logger := loggerFrom(ctx)
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(opts.Concurrency)
+	// Build the options shared by the workers once, in a new slice as the
+	// given one may have spare capacity.
+	remoteOpts := make([]remote.Option, 0, len(opts.RemoteOptions)+1)
+	remoteOpts = append(remoteOpts, opts.RemoteOptions...)
+	remoteOpts = append(remoteOpts, remote.WithContext(gctx))
 	for _, repo := range repos {
 		for _, tag := range tags {
 			imgRef := repo + ":" + tag
-			ref, err := name.ParseReference(imgRef)
-			if err != nil {
-				return err
-			}
-
-			// Use the login credentials from the host docker/podman client config.
-			opts := []remote.Option{
-				remote.WithAuthFromKeychain(authn.DefaultKeychain),
-			}
-
-			// Create a random image.
-			img, err := random.Image(1024, 1)
-			if err != nil {
-				return err
-			}
-
-			log.Printf("pushing test image %s\n", ref.String())
-			if err := remote.Write(ref, img, opts...); err != nil {
-				return err
-			}
+			img, digest := images[tag], imageDigests[tag]
+			g.Go(func() error {
+				ref, err := name.ParseReference(imgRef)
+				if err != nil {
+					return err
+				}
+				logger.Info("Pushing test image", "image", ref.String())
+				if err := remote.Write(ref, img, remoteOpts...); err != nil {
+					return fmt.Errorf("failed to push %s: %w", imgRef, err)
+				}
+				mu.Lock()
+				digests[imgRef] = digest
+				mu.Unlock()
+				return nil
+			})
 		}
 	}
-	return nil
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	return digests, nil
+}
+
+// seededLayer returns a layer with a single file of the given size, whose
+// content is generated from the given seed.
+func seededLayer(seed, size int64) (v1.Layer, error) {
+	content := make([]byte, size)
+	// Deterministic content is wanted, not secure randomness.
+	rand.New(rand.NewSource(seed)).Read(content)
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	if err := tw.WriteHeader(&tar.Header{
+		Name:     "content",
+		Mode:     0o644,
+		Size:     size,
+		Typeflag: tar.TypeReg,
+	}); err != nil {
+		return nil, err
+	}
+	if _, err := tw.Write(content); err != nil {
+		return nil, err
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	b := buf.Bytes()
+	return tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(b)), nil
+	})
 }
 
-// RetagAndPush retags local image based on the remoteImage and pushes the remoteImage
-func RetagAndPush(ctx context.Context, localImage, remoteImage string) error {
-	log.Printf("pushing flux test image %s\n", remoteImage)
-	// Retag local image and push.
-	if err := RunCommand(ctx, "./",
-		fmt.Sprintf("docker tag %s %s", localImage, remoteImage),
-		RunCommandOptions{},
-	); err != nil {
-		return err
-	}
-
-	return RunCommand(ctx, "./",
-		fmt.Sprintf("docker push %s", remoteImage),
-		RunCommandOptions{},
-	)
+// seededImage returns an image with the given layer, labeled with the given
+// tag.
+func seededImage(layer v1.Layer, tag string) (v1.Image, error) {
+	img, err := mutate.AppendLayers(empty.Image, layer)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := img.ConfigFile()
+	if err != nil {
+		return nil, err
+	}
+	cfg = cfg.DeepCopy()
+	cfg.Config.Labels = map[string]string{"tftestenv.tag": tag}
+	return mutate.Config(img, cfg.Config)
+}
+
+// PushedImage is a test app image pushed to a registry.
+type PushedImage struct {
+	// Ref is the reference of the pushed image.
+	Ref string
+	// Digest is the digest of the pushed image.
+	Digest string
+}
+
+// RetagAndPush pushes the local image as the remote image and returns its
+// digest. The local image is read from a tarball, like the output of docker
+// save, or an OCI layout directory if it's a path, and from the docker daemon
+// otherwise. No docker CLI is needed. The remote options default to the
+// credentials of the host docker/podman client config.
+func RetagAndPush(ctx context.Context, localImage, remoteImage string, opts ...remote.Option) (string, error) {
+	img, err := loadLocalImage(ctx, localImage)
+	if err != nil {
+		return "", fmt.Errorf("failed to load image %s: %w", localImage, err)
+	}
+	ref, err := name.ParseReference(remoteImage)
+	if err != nil {
+		return "", err
+	}
+	// Build the options in a new slice as the given one may have spare
+	// capacity and be reused by the caller.
+	remoteOpts := make([]remote.Option, 0, len(opts)+2)
+	if len(opts) == 0 {
+		remoteOpts = append(remoteOpts, remote.WithAuthFromKeychain(authn.DefaultKeychain))
+	}
+	remoteOpts = append(remoteOpts, opts...)
+	remoteOpts = append(remoteOpts, remote.WithContext(ctx))
+
+	loggerFrom(ctx).Info("Pushing flux test image", "image", ref.String())
+	if err := remote.Write(ref, img, remoteOpts...); err != nil {
+		return "", fmt.Errorf("failed to push %s: %w", remoteImage, err)
+	}
+	digest, err := img.Digest()
+	if err != nil {
+		return "", err
+	}
+	return digest.String(), nil
+}
+
+// loadLocalImage reads the given local image from a tarball or an OCI layout
+// directory if it's a path, and from the docker daemon otherwise.
+func loadLocalImage(ctx context.Context, localImage string) (v1.Image, error) {
+	fi, err := os.Stat(localImage)
+	switch {
+	case err == nil && fi.IsDir():
+		return imageFromLayout(localImage)
+	case err == nil:
+		return tarball.ImageFromPath(localImage, nil)
+	}
+
+	ref, err := name.ParseReference(localImage)
+	if err != nil {
+		return nil, err
+	}
+	return daemon.Image(ref, daemon.WithContext(ctx))
+}
+
+// imageFromLayout returns the single image of the OCI layout in the given
+// directory.
+func imageFromLayout(dir string) (v1.Image, error) {
+	index, err := layout.ImageIndexFromPath(dir)
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := index.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+	var images []v1.Hash
+	for _, desc := range manifest.Manifests {
+		if desc.MediaType.IsImage() {
+			images = append(images, desc.Digest)
+		}
+	}
+	if len(images) != 1 {
+		return nil, fmt.Errorf("expected one image in OCI layout %s, got %d", dir, len(images))
+	}
+	return index.Image(images[0])
 }
 
 // ParseCreatedAtTime parses 'createdat' label/tag on resources. The time value
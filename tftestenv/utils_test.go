@@ -17,9 +17,22 @@ limitations under the License.
 package tftestenv
 
 import (
+	"context"
+	"io"
+	"log"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
 	. "github.com/onsi/gomega"
 )
 
@@ -59,3 +72,100 @@ func TestParseCreatedAtTime(t *testing.T) {
 		})
 	}
 }
+
+func TestCreateAndPushImages(t *testing.T) {
+	g := NewWithT(t)
+
+	srv := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	t.Cleanup(srv.Close)
+	host := strings.TrimPrefix(srv.URL, "http://")
+
+	repos := map[string]string{
+		"foo": host + "/test/foo",
+		"bar": host + "/test/bar",
+	}
+	tags := []string{"v1.0.0", "v1.1.0", "v2.0.0"}
+	digests, err := CreateAndPushImages(context.Background(), repos, tags, PushImagesOptions{Seed: 42, Concurrency: 2})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(digests).To(HaveLen(6))
+
+	// The images of a tag are the same in every repository, and differ
+	// between tags.
+	g.Expect(digests[host+"/test/foo:v1.0.0"]).To(Equal(digests[host+"/test/bar:v1.0.0"]))
+	g.Expect(digests[host+"/test/foo:v1.0.0"]).ToNot(Equal(digests[host+"/test/foo:v1.1.0"]))
+
+	ref, err := name.ParseReference(host + "/test/foo:v2.0.0")
+	g.Expect(err).ToNot(HaveOccurred())
+	desc, err := remote.Head(ref)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(desc.Digest.String()).To(Equal(digests[ref.String()]))
+
+	// The same seed generates the same images.
+	again, err := CreateAndPushImages(context.Background(), repos, tags, PushImagesOptions{Seed: 42})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(again).To(Equal(digests))
+	other, err := CreateAndPushImages(context.Background(), repos, tags[:1], PushImagesOptions{Seed: 7})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(other[host+"/test/foo:v1.0.0"]).ToNot(Equal(digests[host+"/test/foo:v1.0.0"]))
+
+	// Remote options with spare capacity are shared by the workers without
+	// being written to.
+	remoteOpts := make([]remote.Option, 1, 4)
+	remoteOpts[0] = remote.WithAuth(authn.Anonymous)
+	_, err = CreateAndPushImages(context.Background(), repos, tags, PushImagesOptions{Seed: 42, RemoteOptions: remoteOpts})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(remoteOpts[:cap(remoteOpts)][1]).To(BeNil())
+}
+
+func TestRetagAndPush(t *testing.T) {
+	g := NewWithT(t)
+
+	srv := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	t.Cleanup(srv.Close)
+	host := strings.TrimPrefix(srv.URL, "http://")
+
+	layer, err := seededLayer(1, 512)
+	g.Expect(err).ToNot(HaveOccurred())
+	img, err := seededImage(layer, "test")
+	g.Expect(err).ToNot(HaveOccurred())
+	want, err := img.Digest()
+	g.Expect(err).ToNot(HaveOccurred())
+
+	dir := t.TempDir()
+	tarPath := filepath.Join(dir, "image.tar")
+	localRef, err := name.ParseReference("ghcr.io/fluxcd/source-controller:latest")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(tarball.WriteToFile(tarPath, localRef, img)).To(Succeed())
+
+	layoutPath := filepath.Join(dir, "layout")
+	p, err := layout.Write(layoutPath, empty.Index)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(p.AppendImage(img)).To(Succeed())
+
+	for _, local := range []string{tarPath, layoutPath} {
+		remoteImage := host + "/source-controller:test"
+		digest, err := RetagAndPush(context.Background(), local, remoteImage)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(digest).To(Equal(want.String()))
+
+		ref, err := name.ParseReference(remoteImage)
+		g.Expect(err).ToNot(HaveOccurred())
+		desc, err := remote.Head(ref)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(desc.Digest).To(Equal(want))
+	}
+	// The push helpers return the digest of every pushed image, and don't
+	// write to the spare capacity of the given remote options.
+	remoteOpts := make([]remote.Option, 1, 4)
+	remoteOpts[0] = remote.WithAuth(authn.Anonymous)
+	pushed, err := PushTestAppImagesLocal(context.Background(), map[string]string{
+		"source-controller":    tarPath,
+		"kustomize-controller": layoutPath,
+	}, host, remoteOpts...)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(pushed).To(Equal(map[string]PushedImage{
+		"source-controller":    {Ref: host + "/source-controller:test", Digest: want.String()},
+		"kustomize-controller": {Ref: host + "/kustomize-controller:test", Digest: want.String()},
+	}))
+	g.Expect(remoteOpts[:cap(remoteOpts)][1]).To(BeNil())
+}
@@ -0,0 +1,103 @@
+/*
+Copyright 2026 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tftestenv
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/hashicorp/terraform-exec/tfexec"
+)
+
+// varsFile is the name of the generated terraform variables file in the
+// build directory.
+const varsFile = "tftestenv.auto.tfvars.json"
+
+// WithVars configures terraform variables for the environment. The variables
+// are written to a generated tftestenv.auto.tfvars.json file in the build
+// directory, which is used for terraform plan, apply and destroy, including the
+// standalone Destroy. The standalone Destroy reuses the recorded file if no
+// variables are given to it. Multiple calls are merged, with the later values
+// taking precedence. Variables set with WithTfApplyOptions or WithTfDestroyOptions
+// take precedence over these.
+func WithVars(vars map[string]any) EnvironmentOption {
+	return func(e *Environment) {
+		if e.vars == nil {
+			e.vars = map[string]any{}
+		}
+		for k, v := range vars {
+			e.vars[k] = v
+		}
+	}
+}
+
+// WithVarFiles configures terraform variable files for the environment, used
+// like the variables of WithVars. Relative paths are relative to the
+// terraform working directory. The variables of WithVars take precedence over
+// those in the files.
+func WithVarFiles(files ...string) EnvironmentOption {
+	return func(e *Environment) {
+		e.varFiles = append(e.varFiles, files...)
+	}
+}
+
+// setUpVars writes the generated variables file in the build directory and
+// adds the variable files to the terraform apply and destroy options. Without
+// variables, the file recorded by a previous run is used for destroy, else it
+// is removed so that a later destroy doesn't use stale variables.
+func (env *Environment) setUpVars(destroy bool) error {
+	files := append([]string{}, env.varFiles...)
+	path := filepath.Join(env.buildDir, varsFile)
+	switch {
+	case len(env.vars) > 0:
+		b, err := json.MarshalIndent(env.vars, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode terraform variables: %w", err)
+		}
+		if err := os.MkdirAll(env.buildDir, os.ModePerm); err != nil {
+			return fmt.Errorf("failed to create build directory: %w", err)
+		}
+		if err := os.WriteFile(path, b, 0o600); err != nil {
+			return fmt.Errorf("failed to write terraform variables: %w", err)
+		}
+		files = append(files, path)
+	case destroy:
+		if _, err := os.Stat(path); err == nil {
+			env.phaseLogger("destroy").Info("Using recorded terraform variables", "path", path)
+			files = append(files, path)
+		}
+	default:
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove stale terraform variables: %w", err)
+		}
+	}
+
+	// Prepend the variable files so that the explicitly configured terraform
+	// options take precedence.
+	var applyOpts []tfexec.ApplyOption
+	var destroyOpts []tfexec.DestroyOption
+	for _, f := range files {
+		applyOpts = append(applyOpts, tfexec.VarFile(f))
+		destroyOpts = append(destroyOpts, tfexec.VarFile(f))
+	}
+	env.tfApplyOptions = append(applyOpts, env.tfApplyOptions...)
+	env.tfDestroyOptions = append(destroyOpts, env.tfDestroyOptions...)
+	return nil
+}
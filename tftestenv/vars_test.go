@@ -0,0 +1,96 @@
+/*
+Copyright 2026 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tftestenv
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/terraform-exec/tfexec"
+	. "github.com/onsi/gomega"
+)
+
+func TestSetUpVars(t *testing.T) {
+	g := NewWithT(t)
+
+	env := &Environment{buildDir: t.TempDir()}
+	opts := []EnvironmentOption{
+		WithVars(map[string]any{"name": "foo", "node_count": 1}),
+		WithVars(map[string]any{"node_count": 2, "tags": map[string]string{"ci": "true"}}),
+		WithVarFiles("common.tfvars"),
+		WithTfApplyOptions(tfexec.Var("name=bar")),
+	}
+	for _, opt := range opts {
+		opt(env)
+	}
+	g.Expect(env.setUpVars(false)).To(Succeed())
+
+	path := filepath.Join(env.buildDir, varsFile)
+	b, err := os.ReadFile(path)
+	g.Expect(err).ToNot(HaveOccurred())
+	var vars map[string]any
+	g.Expect(json.Unmarshal(b, &vars)).To(Succeed())
+	g.Expect(vars).To(Equal(map[string]any{
+		"name":       "foo",
+		"node_count": float64(2),
+		"tags":       map[string]any{"ci": "true"},
+	}))
+
+	// The same variable files are used for apply and destroy, before the
+	// explicitly configured options.
+	g.Expect(env.tfApplyOptions).To(Equal([]tfexec.ApplyOption{
+		tfexec.VarFile("common.tfvars"), tfexec.VarFile(path), tfexec.Var("name=bar"),
+	}))
+	g.Expect(env.tfDestroyOptions).To(Equal([]tfexec.DestroyOption{
+		tfexec.VarFile("common.tfvars"), tfexec.VarFile(path),
+	}))
+}
+
+func TestDestroy_recordedVars(t *testing.T) {
+	g := NewWithT(t)
+	t.Chdir(t.TempDir())
+	// Ensure that no terraform binary is found in PATH.
+	t.Setenv("PATH", t.TempDir())
+
+	// Terraform stand-in which records the arguments of destroy.
+	installDir := t.TempDir()
+	argsPath := filepath.Join(installDir, "destroy-args")
+	script := fakeTerraform + `if [ "$1" = destroy ]; then echo "$@" > "` + argsPath + `"; fi
+`
+	g.Expect(os.WriteFile(filepath.Join(installDir, "terraform"), []byte(script), 0o755)).To(Succeed())
+
+	// The test run records its variables.
+	buildDir, err := filepath.Abs("build")
+	g.Expect(err).ToNot(HaveOccurred())
+	env := &Environment{buildDir: buildDir}
+	WithVars(map[string]any{"name": "foo"})(env)
+	g.Expect(env.setUpVars(false)).To(Succeed())
+
+	// A later destroy without variables uses the recorded ones.
+	g.Expect(Destroy(context.TODO(), t.TempDir(), WithTerraformInstallDir(installDir))).To(Succeed())
+	args, err := os.ReadFile(argsPath)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(string(args)).To(ContainSubstring("-var-file=" + filepath.Join(buildDir, varsFile)))
+
+	// A test run without variables removes the stale record.
+	env = &Environment{buildDir: buildDir}
+	g.Expect(env.setUpVars(false)).To(Succeed())
+	g.Expect(filepath.Join(buildDir, varsFile)).ToNot(BeAnExistingFile())
+}
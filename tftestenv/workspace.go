@@ -0,0 +1,199 @@
+/*
+Copyright 2026 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tftestenv
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-exec/tfexec"
+)
+
+const (
+	// defaultWorkspace is the name of the terraform default workspace.
+	defaultWorkspace = "default"
+	// workspaceFile is the name of the file in the build directory which
+	// records the name of an auto-generated workspace. With a run ID, the run
+	// ID is appended to it.
+	workspaceFile = "workspace"
+	// dataDir is the name of the terraform data directory in the build
+	// directory, which holds the current workspace. With a run ID, the run ID
+	// is appended to it.
+	dataDir = ".terraform"
+)
+
+// RunIDEnv is the environment variable with the ID of the current run, like
+// the CI job ID. It keys the record of the auto-generated workspace, so that
+// concurrent runs sharing a build directory don't overwrite each other's
+// record.
+const RunIDEnv = "TFTESTENV_RUN_ID"
+
+// WithWorkspace configures the Environment to run terraform in the given
+// workspace. The workspace is created if it doesn't exist and is deleted once
+// the infrastructure in it has been destroyed. The selected workspace is kept in a
+// terraform data directory in the build directory, keyed by RunIDEnv if set,
+// so runs sharing the terraform directory don't switch each other's workspace.
+func WithWorkspace(name string) EnvironmentOption {
+	return func(e *Environment) {
+		e.workspace = name
+	}
+}
+
+// WithAutoWorkspace configures the Environment to run terraform in a new
+// workspace generated for every run. The name of the workspace is recorded in
+// the build directory so that Destroy, run in a later CI step with the same
+// option, and New with WithExisting target the same workspace. Concurrent runs
+// sharing a build directory must set a distinct RunIDEnv, the record is keyed
+// by it. WithWorkspace takes precedence over it.
+func WithAutoWorkspace(auto bool) EnvironmentOption {
+	return func(e *Environment) {
+		e.autoWorkspace = auto
+	}
+}
+
+// resolveWorkspace sets the name of the workspace of the Environment. In
+// auto-generated workspace mode, a new name is generated and recorded in the
+// build directory if generate is true, else the recorded name is used. An
+// existing record is never overwritten, as it may be the workspace of a run
+// that wasn't destroyed.
+func (env *Environment) resolveWorkspace(buildDir string, generate bool) error {
+	if env.workspace != "" || !env.autoWorkspace {
+		return nil
+	}
+
+	path := workspaceRecordPath(buildDir)
+	env.workspaceRecord = path
+	if !generate {
+		name, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read auto-generated workspace name: %w", err)
+		}
+		env.workspace = strings.TrimSpace(string(name))
+		return nil
+	}
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("auto-generated workspace record %s already exists: destroy it or set a distinct %s", path, RunIDEnv)
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return fmt.Errorf("failed to generate workspace name: %w", err)
+	}
+	env.workspace = fmt.Sprintf("tftestenv-%s-%s", time.Now().UTC().Format("20060102-150405"), hex.EncodeToString(suffix))
+	if err := os.WriteFile(path, []byte(env.workspace), 0o644); err != nil {
+		return fmt.Errorf("failed to record auto-generated workspace name: %w", err)
+	}
+	return nil
+}
+
+// workspaceRecordPath returns the path of the auto-generated workspace record
+// in the given build directory, keyed by the run ID if set.
+func workspaceRecordPath(buildDir string) string {
+	return runPath(buildDir, workspaceFile)
+}
+
+// runPath returns the path of the given file in the build directory, keyed by
+// the run ID if set.
+func runPath(buildDir, name string) string {
+	runID := os.Getenv(RunIDEnv)
+	if runID == "" {
+		return filepath.Join(buildDir, name)
+	}
+	// Keep the run ID usable as a file name.
+	runID = strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.' {
+			return r
+		}
+		return '-'
+	}, runID)
+	return filepath.Join(buildDir, name+"-"+runID)
+}
+
+// selectWorkspace selects the workspace of the Environment, creating it if it
+// doesn't exist.
+func (env *Environment) selectWorkspace(ctx context.Context, create bool) error {
+	if env.workspace == "" {
+		return nil
+	}
+
+	workspaces, current, err := env.tf.WorkspaceList(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list workspaces: %w", err)
+	}
+	if current == env.workspace {
+		return nil
+	}
+	if slices.Contains(workspaces, env.workspace) {
+		env.phaseLogger("init").Info("Selecting workspace", "workspace", env.workspace)
+		return env.tf.WorkspaceSelect(ctx, env.workspace)
+	}
+	if !create {
+		return fmt.Errorf("workspace %q not found", env.workspace)
+	}
+	env.phaseLogger("init").Info("Creating workspace", "workspace", env.workspace)
+	return env.tf.WorkspaceNew(ctx, env.workspace)
+}
+
+// setDataDir configures terraform to keep its data directory, including the
+// selected workspace, in the build directory instead of the shared terraform
+// directory, so that environments running terraform in the same directory
+// don't switch each other's workspace.
+func setDataDir(tf *tfexec.Terraform, buildDir string) error {
+	env := map[string]string{}
+	for _, kv := range os.Environ() {
+		k, v, _ := strings.Cut(kv, "=")
+		env[k] = v
+	}
+	// tfexec manages these variables itself and rejects them.
+	for _, k := range tfexec.ProhibitedEnv(env) {
+		delete(env, k)
+	}
+	env["TF_DATA_DIR"] = runPath(buildDir, dataDir)
+	return tf.SetEnv(env)
+}
+
+// deleteWorkspace deletes the workspace of the Environment after its
+// infrastructure has been destroyed, and removes the record of an
+// auto-generated workspace from the build directory.
+func (env *Environment) deleteWorkspace(ctx context.Context) error {
+	if env.workspace == "" || env.workspace == defaultWorkspace {
+		return nil
+	}
+
+	env.phaseLogger("destroy").Info("Deleting workspace", "workspace", env.workspace)
+	// The current workspace can't be deleted.
+	if err := env.tf.WorkspaceSelect(ctx, defaultWorkspace); err != nil {
+		return fmt.Errorf("failed to select default workspace: %w", err)
+	}
+	if err := env.tf.WorkspaceDelete(ctx, env.workspace); err != nil {
+		return fmt.Errorf("failed to delete workspace %q: %w", env.workspace, err)
+	}
+	if env.workspaceRecord != "" {
+		if err := os.Remove(env.workspaceRecord); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove auto-generated workspace record: %w", err)
+		}
+	}
+	return nil
+}
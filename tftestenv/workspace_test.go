@@ -0,0 +1,117 @@
+/*
+Copyright 2026 The Flux authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tftestenv
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/terraform-exec/tfexec"
+	. "github.com/onsi/gomega"
+)
+
+func TestResolveWorkspace(t *testing.T) {
+	g := NewWithT(t)
+	buildDir := t.TempDir()
+
+	// Destroy before any run has recorded a workspace.
+	env := &Environment{}
+	WithAutoWorkspace(true)(env)
+	g.Expect(env.resolveWorkspace(buildDir, false)).ToNot(Succeed())
+
+	// New generates and records the workspace.
+	g.Expect(env.resolveWorkspace(buildDir, true)).To(Succeed())
+	g.Expect(env.workspace).To(MatchRegexp(`^tftestenv-\d{8}-\d{6}-[0-9a-f]{8}$`))
+
+	// Destroy uses the recorded workspace.
+	destroyEnv := &Environment{}
+	WithAutoWorkspace(true)(destroyEnv)
+	g.Expect(destroyEnv.resolveWorkspace(buildDir, false)).To(Succeed())
+	g.Expect(destroyEnv.workspace).To(Equal(env.workspace))
+
+	// An explicit workspace takes precedence.
+	namedEnv := &Environment{}
+	WithAutoWorkspace(true)(namedEnv)
+	WithWorkspace("ci")(namedEnv)
+	g.Expect(namedEnv.resolveWorkspace(buildDir, true)).To(Succeed())
+	g.Expect(namedEnv.workspace).To(Equal("ci"))
+}
+
+func TestResolveWorkspaceRunID(t *testing.T) {
+	g := NewWithT(t)
+	buildDir := t.TempDir()
+
+	// Concurrent runs in the same build directory have their own records.
+	t.Setenv(RunIDEnv, "job/1")
+	env1 := &Environment{}
+	WithAutoWorkspace(true)(env1)
+	g.Expect(env1.resolveWorkspace(buildDir, true)).To(Succeed())
+	g.Expect(env1.workspaceRecord).To(Equal(filepath.Join(buildDir, "workspace-job-1")))
+
+	t.Setenv(RunIDEnv, "job-2")
+	env2 := &Environment{}
+	WithAutoWorkspace(true)(env2)
+	g.Expect(env2.resolveWorkspace(buildDir, true)).To(Succeed())
+	g.Expect(env2.workspace).ToNot(Equal(env1.workspace))
+
+	// A run doesn't overwrite the record of a run that wasn't destroyed.
+	again := &Environment{}
+	WithAutoWorkspace(true)(again)
+	g.Expect(again.resolveWorkspace(buildDir, true)).ToNot(Succeed())
+
+	// Destroy of the first run targets its own workspace.
+	t.Setenv(RunIDEnv, "job/1")
+	destroyEnv := &Environment{}
+	WithAutoWorkspace(true)(destroyEnv)
+	g.Expect(destroyEnv.resolveWorkspace(buildDir, false)).To(Succeed())
+	g.Expect(destroyEnv.workspace).To(Equal(env1.workspace))
+}
+
+func TestDestroyWorkspaceDeleteError(t *testing.T) {
+	g := NewWithT(t)
+	dir := t.TempDir()
+	t.Setenv(RunIDEnv, "job-1")
+
+	// Terraform stand-in which records its data directory on destroy and
+	// fails to delete workspaces.
+	tfPath := filepath.Join(dir, "terraform")
+	script := `#!/bin/sh
+case "$1" in
+destroy) echo "$TF_DATA_DIR" > "` + filepath.Join(dir, "datadir") + `" ;;
+workspace) if [ "$2" = delete ]; then echo "workspace is locked" >&2; exit 1; fi ;;
+esac
+`
+	g.Expect(os.WriteFile(tfPath, []byte(script), 0o755)).To(Succeed())
+	tf, err := tfexec.NewTerraform(dir, tfPath)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(setDataDir(tf, dir)).To(Succeed())
+
+	env := &Environment{tf: tf, buildDir: dir}
+	WithWorkspace("ci")(env)
+	err = env.destroy(context.TODO())
+	g.Expect(err).To(MatchError(ContainSubstring(`failed to delete workspace "ci"`)))
+	var destroyErr *DestroyError
+	g.Expect(errors.As(err, &destroyErr)).To(BeFalse())
+	g.Expect(filepath.Join(dir, leftoversFile)).ToNot(BeAnExistingFile())
+
+	b, err := os.ReadFile(filepath.Join(dir, "datadir"))
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(string(b)).To(Equal(filepath.Join(dir, ".terraform-job-1") + "\n"))
+}